@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"reflect"
+	"syscall"
 
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
 	"github.com/Amanuel-0/gorm-pg/internals/config"
 	"github.com/Amanuel-0/gorm-pg/internals/database"
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/rowmapper"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"github.com/Amanuel-0/gorm-pg/internals/events"
+	apihttp "github.com/Amanuel-0/gorm-pg/internals/http"
 	"github.com/Amanuel-0/gorm-pg/internals/queries/level5"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
 
 	// "github.com/Amanuel-0/gorm-pg/internals/queries/level1"
 
@@ -33,8 +44,26 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
+	// cache the read queries asking for it (cache.Cached)
+	store, err := cache.New(context.Background(), config)
+	if err != nil {
+		log.Fatalf("failed to set up the query cache: %v", err)
+	}
+	if err := db.Use(&cache.Plugin{Store: store}); err != nil {
+		log.Fatalf("failed to register the query cache: %v", err)
+	}
+	// publish notifications and exchange changes to the live streams
+	broker, err := events.New(context.Background(), config, db)
+	if err != nil {
+		log.Fatalf("failed to set up the event broker: %v", err)
+	}
+	if err := db.Use(&events.Plugin{Broker: broker}); err != nil {
+		log.Fatalf("failed to register the event plugin: %v", err)
+	}
 	// Migrate database tables
-	autoMigrateTables(db)
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("failed to migrate database: %v", err)
+	}
 	//
 	//
 	// Seed initial data (idempotent)
@@ -97,14 +126,17 @@ func main() {
 	// level4.GetPaidCommunities(db)
 	// level4.GetExchangesOfUser(db)
 	// level4.GetBooksOfUserInCompletedExchanges(db)
+	// level4.GetExchangeParticipants(db)
 
 	//
 	// Level 5
 	//
 	// level5.GetTop5UsersByBooksOwned(db)
+	// level5.GetTop5UsersByBooksCount(db)
 	// level5.AuthorsWithMostBookListed(db)
 	// level5.GetAvgUserRating(db)
 	// level5.GetBooksWithCondReviewAndRaring(db)
+	// level5.GetTopRatedBooks(db)
 	// level5.ListUsersMessageStatsByMonth(db)
 	// level5.GetUsersWithNoExchangeHistory(db)
 	// level5.TotalRevenuePerMonth(db)
@@ -112,42 +144,38 @@ func main() {
 	// level5.GetUsersWithDisputedExchanges(db)
 	level5.GetActiveCommunities(db)
 
+	//
+	// Bonus
+	//
+	// bonus.GetThreadMessagesPaginated(db)
+	// bonus.GetCommunityThreadsProjected(db)
+
 	// playWithGORMqueries(db)
 
-}
+	//
+	// HTTP API
+	//
+	// repositories get their db (or the transaction they run in) from the
+	// txmanager, the handlers get the repositories
+	repos := repository.New(txmanager.New(db))
+	hub := events.NewHub(broker)
+	// access tokens are JWTs signed with the key of JWT_SECRET_KEY
+	tokens, err := auth.NewTokens(config.Auth)
+	if err != nil {
+		log.Fatalf("failed to load the token signing key: %v", err)
+	}
+	sessions := auth.NewService(repos.Accounts, tokens)
+	server := apihttp.New(config.HTTP, apihttp.Deps{DB: db, Config: config, Repos: repos, Auth: sessions, Events: hub, Sessions: sessions})
 
-func autoMigrateTables(db *gorm.DB) {
-	if err := db.AutoMigrate(
-		&models.ActivityLog{},
-		&models.Author{},
-		&models.BookImage{},
-		&models.BookReview{},
-		&models.Book{},
-		&models.ChatThread{},
-		&models.CommunityMember{},
-		&models.CommunityMessage{},
-		&models.CommunityThread{},
-		&models.Community{},
-		&models.Exchange{},
-		&models.Genre{},
-		// locations starts
-		&models.Country{},
-		&models.State{},
-		&models.City{},
-		// locations ends
-		&models.MessageQuotaUsage{},
-		&models.Message{},
-		&models.ModerationAction{},
-		&models.Notification{},
-		&models.Report{},
-		&models.SubscriptionPlan{},
-		&models.Subscription{},
-		&models.UserProfile{},
-		&models.UserRating{},
-		&models.User{},
-		&models.Payment{},
-	); err != nil {
-		log.Fatalf("failed to migrate database: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		if err := hub.Run(ctx); err != nil {
+			log.Printf("event hub stopped: %v", err)
+		}
+	}()
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("http server failed: %v", err)
 	}
 }
 
@@ -232,16 +260,9 @@ func playWithGORMqueries(db *gorm.DB) {
 	}
 	// prettyPrint(users, "Method 3: Users")
 
-	// find a single user with a join
-	var result struct {
-		ID        uint   `json:"id"`
-		FirstName string `json:"first_name"`
-		LastName  string `json:"last_name"`
-		Bio       string `json:"bio"`
-		AvatarURL string `json:"avatar_url"`
-	}
-	// create a struct to create a wrapper for user and user profile table to be nested
-	var resultWrapper struct {
+	// find a single user with a join, the `user_profile__` aliases are
+	// scanned into the nested UserProfile struct by rowmapper
+	type resultWrapper struct {
 		ID          uint   `json:"id"`
 		FirstName   string `json:"first_name"`
 		LastName    string `json:"last_name"`
@@ -250,21 +271,14 @@ func playWithGORMqueries(db *gorm.DB) {
 			AvatarURL string `json:"avatar_url"`
 		}
 	}
-	// var joinUser models.User
-	jur := db.Model(&models.User{}).
-		Select("users.id, users.first_name, users.last_name, user_profiles.bio, user_profiles.avatar_url").
+	result, err := rowmapper.Find[resultWrapper](db.Model(&models.User{}).
+		Select("users.id, users.first_name, users.last_name, user_profiles.bio AS user_profile__bio, user_profiles.avatar_url AS user_profile__avatar_url").
 		Joins("left join user_profiles on user_profiles.user_id = users.id").
-		First(&result)
-	if jur.Error != nil {
-		log.Fatalf("failed to get joined user: %v", jur.Error)
+		Limit(1))
+	if err != nil {
+		log.Fatalf("failed to get joined user: %v", err)
 	}
 
-	resultWrapper.ID = result.ID
-	resultWrapper.FirstName = result.FirstName
-	resultWrapper.LastName = result.LastName
-	resultWrapper.UserProfile.Bio = result.Bio
-	resultWrapper.UserProfile.AvatarURL = result.AvatarURL
-
-	// prettyPrint(result, "Joined User")
+	prettyPrint(result, "Joined User")
 
 }
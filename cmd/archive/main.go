@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database"
+	"github.com/Amanuel-0/gorm-pg/internals/database/archive"
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
+)
+
+// archive moves the exchanges over for longer than -older-than, with their
+// chat threads and messages, to the archive tables:
+//
+//	go run ./cmd/archive -older-than 4320h -batch 100
+func main() {
+	olderThan := flag.Duration("older-than", 180*24*time.Hour, "archive what hasn't changed for this long")
+	batch := flag.Int("batch", archive.DefaultBatchSize, "exchanges (or threads) per transaction")
+	flag.Parse()
+
+	// Load Configuration
+	config, err := config.New()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
+	// database connection string
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", config.DB.Username, config.DB.Password, config.DB.Host, config.DB.Port, config.DB.DBName)
+	db, err := database.ConnectDB(dsn)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
+	// drop the cached queries reading what goes away, for the instances
+	// sharing the cache
+	store, err := cache.New(context.Background(), config)
+	if err != nil {
+		log.Fatalf("failed to set up the query cache: %v", err)
+	}
+	if err := db.Use(&cache.Plugin{Store: store}); err != nil {
+		log.Fatalf("failed to register the query cache: %v", err)
+	}
+
+	if err := archive.Migrate(db); err != nil {
+		log.Fatalf("failed to migrate archive tables: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	archiver := archive.New(db)
+	archiver.BatchSize = *batch
+	cutoff := time.Now().Add(-*olderThan)
+	r, err := archiver.Run(ctx, cutoff)
+	log.Printf("archive: cutoff=%s exchanges=%d threads=%d messages=%d batches=%d",
+		cutoff.Format(time.DateTime), r.Exchanges, r.Threads, r.Messages, r.Batches)
+	if err != nil {
+		log.Fatalf("archive: %v", err)
+	}
+}
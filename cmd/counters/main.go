@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database"
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
+	"github.com/Amanuel-0/gorm-pg/internals/database/counter"
+)
+
+// counters recomputes the denormalised counters from their children and
+// fixes the ones that drifted:
+//
+//	go run ./cmd/counters -dry-run
+//	go run ./cmd/counters
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report the drifted counters")
+	flag.Parse()
+
+	// Load Configuration
+	config, err := config.New()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
+	// database connection string
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", config.DB.Username, config.DB.Password, config.DB.Host, config.DB.Port, config.DB.DBName)
+	db, err := database.ConnectDB(dsn)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
+	// drop the cached queries reading the fixed counters, for the instances
+	// sharing the cache
+	store, err := cache.New(context.Background(), config)
+	if err != nil {
+		log.Fatalf("failed to set up the query cache: %v", err)
+	}
+	if err := db.Use(&cache.Plugin{Store: store}); err != nil {
+		log.Fatalf("failed to register the query cache: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	drifts, err := counter.Reconcile(ctx, db, *dryRun, counter.Defaults()...)
+	for _, d := range drifts {
+		log.Printf("counters: %-32s id=%d stored=%d actual=%d", d.Counter, d.ID, d.Stored, d.Actual)
+	}
+	log.Printf("counters: %d drifted, dry_run=%t", len(drifts), *dryRun)
+	if err != nil {
+		log.Fatalf("counters: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database"
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
+	"github.com/Amanuel-0/gorm-pg/internals/database/retention"
+)
+
+// retention applies the retention policies to the soft deleted rows, once or
+// every -every when run as a long lived job:
+//
+//	go run ./cmd/retention -dry-run
+//	go run ./cmd/retention -every 24h -batch 200 -pause 100ms
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only count the rows that are due")
+	batch := flag.Int("batch", retention.DefaultBatchSize, "rows per transaction")
+	pause := flag.Duration("pause", 0, "pause between batches")
+	every := flag.Duration("every", 0, "run periodically instead of once")
+	flag.Parse()
+
+	// Load Configuration
+	config, err := config.New()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
+	// database connection string
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", config.DB.Username, config.DB.Password, config.DB.Host, config.DB.Port, config.DB.DBName)
+	db, err := database.ConnectDB(dsn)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+
+	// drop the cached queries reading what goes away, for the instances
+	// sharing the cache
+	store, err := cache.New(context.Background(), config)
+	if err != nil {
+		log.Fatalf("failed to set up the query cache: %v", err)
+	}
+	if err := db.Use(&cache.Plugin{Store: store}); err != nil {
+		log.Fatalf("failed to register the query cache: %v", err)
+	}
+
+	engine, err := retention.New(db, retention.Defaults()...)
+	if err != nil {
+		log.Fatalf("invalid retention policies: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	opts := retention.Options{DryRun: *dryRun, BatchSize: *batch, Pause: *pause}
+	if *every > 0 {
+		engine.Schedule(ctx, *every, opts, report)
+		return
+	}
+	report(engine.Run(ctx, opts))
+}
+
+func report(results []retention.Result, err error) {
+	for _, r := range results {
+		log.Printf("retention: %-14s %-9s table=%s cutoff=%s due=%d done=%d skipped=%d batches=%d dry_run=%t took=%s",
+			r.Policy, r.Action, r.Table, r.Cutoff.Format(time.DateTime), r.Due, r.Done, r.Skipped, r.Batches, r.DryRun, r.Took)
+	}
+	if err != nil {
+		log.Printf("retention: %v", err)
+	}
+}
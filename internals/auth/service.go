@@ -0,0 +1,264 @@
+// Package auth registers users and logs them in and out.
+//
+// Passwords are hashed with argon2id (HashPassword); bcrypt hashes are still
+// accepted and, like argon2id ones made with older parameters, replaced at
+// the next successful login. A login starts a session, logged in the
+// activity log, and gets an access token (a JWT signed with ES256) naming
+// its user and session; logging out ends the session, its tokens stop
+// working before they expire:
+//
+//	tokens, err := auth.NewTokens(config.Auth)
+//	svc := auth.NewService(repos.Accounts, tokens)
+//	session, err := svc.Login(ctx, auth.Credentials{Login: "jane@example.com", Password: "..."}, client)
+//	user, err := svc.Authenticate(r) // Authorization: Bearer <session.Token>
+//
+// Every login attempt is logged, failed ones included, with the client's IP
+// address and user agent.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+)
+
+var (
+	// ErrUnauthenticated is returned for a request without a valid access
+	// token of a live session.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrInvalidCredentials is returned for a login with an unknown login or
+	// a wrong password, which one isn't told.
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	// ErrDeactivated is returned for a login of a deactivated account.
+	ErrDeactivated = errors.New("account is deactivated")
+)
+
+// Service registers users and logs them in and out. It is the
+// Authenticator of the HTTP API.
+type Service struct {
+	accounts *repository.AccountRepository
+	tokens   *Tokens
+	// dummyHash is verified against when the login matches no account, so
+	// that a miss takes as long as a wrong password
+	dummyHash string
+}
+
+// NewService returns a Service storing accounts through accounts and
+// issuing tokens.
+func NewService(accounts *repository.AccountRepository, tokens *Tokens) *Service {
+	dummy, err := HashPassword("not a password")
+	if err != nil {
+		panic(err)
+	}
+	return &Service{accounts: accounts, tokens: tokens, dummyHash: dummy}
+}
+
+// Registration is what a user registers with.
+type Registration struct {
+	Email       string
+	Phone       string
+	Password    string
+	FirstName   string
+	LastName    string
+	DisplayName string
+}
+
+// Register creates the user of reg and its profile, its password hashed; a
+// *dberrors.ErrDuplicate when the email or phone is taken.
+func (s *Service) Register(ctx context.Context, reg Registration) (*models.User, error) {
+	hash, err := HashPassword(reg.Password)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{
+		Email:        NormalizeEmail(reg.Email),
+		Phone:        NormalizePhone(reg.Phone),
+		PasswordHash: hash,
+		FirstName:    reg.FirstName,
+		LastName:     reg.LastName,
+		IsActive:     true,
+		Role:         models.RoleUser,
+	}
+	profile := models.UserProfile{FirstName: reg.FirstName, LastName: reg.LastName, DisplayName: reg.DisplayName}
+	if err := s.accounts.Register(ctx, &user, &profile); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Credentials are what a user logs in with, Login being their email or
+// phone.
+type Credentials struct {
+	Login    string
+	Password string
+}
+
+// Client is who a login or logout comes from, for the activity log.
+type Client struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// Session is a successful login.
+type Session struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"`
+}
+
+// Login checks creds and starts a session, an ErrInvalidCredentials or
+// ErrDeactivated when it can't. The password hash is replaced when it is
+// outdated (see VerifyPassword).
+func (s *Service) Login(ctx context.Context, creds Credentials, client Client) (*Session, error) {
+	column, login := "email", NormalizeEmail(creds.Login)
+	if !strings.Contains(login, "@") {
+		column, login = "phone", NormalizePhone(creds.Login)
+	}
+	user, err := s.accounts.ByLogin(ctx, column, login)
+	var notFound *dberrors.ErrNotFound
+	switch {
+	case errors.As(err, &notFound):
+		VerifyPassword(s.dummyHash, creds.Password)
+		return nil, s.failed(ctx, nil, client, column, "unknown account", ErrInvalidCredentials)
+	case err != nil:
+		return nil, err
+	}
+
+	ok, rehash, err := VerifyPassword(user.PasswordHash, creds.Password)
+	switch {
+	case errors.Is(err, ErrUnknownHash):
+		// e.g. a password stored in plain text, it has to be reset
+		return nil, s.failed(ctx, &user.ID, client, column, "unusable password hash", ErrInvalidCredentials)
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, s.failed(ctx, &user.ID, client, column, "wrong password", ErrInvalidCredentials)
+	case !user.IsActive:
+		return nil, s.failed(ctx, &user.ID, client, column, "deactivated", ErrDeactivated)
+	}
+
+	var rehashed string
+	if rehash {
+		if rehashed, err = HashPassword(creds.Password); err != nil {
+			return nil, err
+		}
+	}
+	session := activity(client, map[string]any{"success": true, "by": column})
+	if err := s.accounts.StartSession(ctx, user, rehashed, &session); err != nil {
+		return nil, err
+	}
+	token, expires, err := s.tokens.Issue(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Token: token, ExpiresAt: expires, User: user}, nil
+}
+
+// failed logs a failed login and returns err.
+func (s *Service) failed(ctx context.Context, userID *uint, client Client, by, reason string, err error) error {
+	attempt := activity(client, map[string]any{"success": false, "by": by, "reason": reason})
+	attempt.UserID = userID
+	if logErr := s.accounts.LogAttempt(ctx, &attempt); logErr != nil {
+		return logErr
+	}
+	return err
+}
+
+// activity is an activity log of client with payload.
+func activity(client Client, payload map[string]any) models.ActivityLog {
+	raw, _ := json.Marshal(payload)
+	return models.ActivityLog{
+		Payload:   string(raw),
+		IPAddress: client.IP,
+		UserAgent: truncate(client.UserAgent, 255),
+		RequestID: truncate(client.RequestID, 100),
+	}
+}
+
+// Logout ends the session of token, an ErrUnauthenticated when it already
+// ended.
+func (s *Service) Logout(ctx context.Context, token string, client Client) error {
+	userID, sessionID, err := s.tokens.Parse(token)
+	if err != nil {
+		return ErrUnauthenticated
+	}
+	if _, err := s.sessionUser(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	logout := activity(client, map[string]any{"session_id": sessionID})
+	return s.accounts.EndSession(ctx, userID, sessionID, &logout)
+}
+
+// Authenticate returns the user of the access token of r, sent as a bearer
+// token. Browsers can't set headers on WebSockets and event streams, those
+// may send it as the access_token query parameter instead.
+func (s *Service) Authenticate(r *http.Request) (*models.User, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	userID, sessionID, err := s.tokens.Parse(token)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	return s.sessionUser(r.Context(), userID, sessionID)
+}
+
+func (s *Service) sessionUser(ctx context.Context, userID, sessionID uint) (*models.User, error) {
+	user, err := s.accounts.SessionUser(ctx, userID, sessionID)
+	var notFound *dberrors.ErrNotFound
+	if errors.As(err, &notFound) {
+		// logged out, or the user is gone
+		return nil, ErrUnauthenticated
+	}
+	return user, err
+}
+
+// BearerToken returns the access token r carries, see Authenticate.
+func BearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	streaming := strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if r.Method == http.MethodGet && streaming {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// NormalizeEmail is email as it is stored: trimmed and lowercase.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone is phone as it is stored: its digits only, "+1 (555)
+// 123-0001" is 15551230001.
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// not in the middle of a rune
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens issues and checks the access tokens, JWTs signed with ES256.
+type Tokens struct {
+	key      *ecdsa.PrivateKey
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// Claims are the claims of an access token: the user is the subject and the
+// session the id of its login.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID uint `json:"sid"`
+}
+
+// NewTokens returns the Tokens configured by cfg, its signing key a P-256
+// PKCS#8 PEM.
+func NewTokens(cfg *config.Auth) (*Tokens, error) {
+	block, _ := pem.Decode([]byte(cfg.SigningKey))
+	if block == nil {
+		return nil, errors.New("auth: the signing key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("auth: parsing the signing key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("auth: the signing key must be a P-256 EC key")
+	}
+	return &Tokens{key: key, issuer: cfg.Issuer, audience: cfg.Audience, ttl: cfg.TokenTTL}, nil
+}
+
+// Issue returns an access token of userID for the session sessionID and
+// when it expires.
+func (t *Tokens) Issue(userID, sessionID uint) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(t.ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			Audience:  jwt.ClaimStrings{t.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		SessionID: sessionID,
+	})
+	signed, err := token.SignedString(t.key)
+	return signed, expires, err
+}
+
+// Parse checks token and returns its user and session.
+func (t *Tokens) Parse(token string) (userID, sessionID uint, err error) {
+	var claims Claims
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return &t.key.PublicKey, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(t.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 0)
+	if err != nil || id == 0 || claims.SessionID == 0 {
+		return 0, 0, errors.New("auth: token without user or session")
+	}
+	return uint(id), claims.SessionID, nil
+}
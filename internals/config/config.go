@@ -2,12 +2,20 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type (
 	Container struct {
 		AppConfig *App
 		DB        *DB
+		Redis     *Redis
+		Cache     *Cache
+		HTTP      *HTTP
+		Events    *Events
+		Auth      *Auth
 	}
 
 	App struct {
@@ -21,6 +29,56 @@ type (
 		Password string
 		DBName   string
 	}
+
+	Redis struct {
+		Host     string
+		Port     string
+		Password string
+	}
+
+	Cache struct {
+		// Backend is "memory" (per instance LRU) or "redis"
+		Backend string
+		// Size is the number of entries of the memory backend
+		Size int
+	}
+
+	HTTP struct {
+		// Addr is the address the API listens on, e.g. ":8080"
+		Addr string
+		// AllowOrigins are the origins allowed by CORS, "*" for any
+		AllowOrigins []string
+		// BodyLimit caps the size of request bodies, e.g. "2M"
+		BodyLimit string
+		// RequestTimeout bounds the handling of one request, the context
+		// of its queries is cancelled after it
+		RequestTimeout time.Duration
+		ReadTimeout    time.Duration
+		WriteTimeout   time.Duration
+		IdleTimeout    time.Duration
+	}
+
+	Events struct {
+		// Backend carries the live events between instances: "local" (a
+		// single instance), "redis" (pub/sub) or "poll" (each instance polls
+		// the database; no chat, its events aren't rows to poll)
+		Backend string
+		// PollInterval is how often the poll backend looks for new rows
+		PollInterval time.Duration
+		// Heartbeat is how often an idle event stream gets a comment, so
+		// proxies don't close it
+		Heartbeat time.Duration
+	}
+
+	Auth struct {
+		// SigningKey is the PEM encoded EC private key (PKCS#8) signing the
+		// access tokens, ES256
+		SigningKey string
+		Issuer     string
+		Audience   string
+		// TokenTTL is how long an access token is valid
+		TokenTTL time.Duration
+	}
 )
 
 func New() (*Container, error) {
@@ -36,7 +94,66 @@ func New() (*Container, error) {
 		DBName:   os.Getenv("DB_NAME"),
 	}
 
-	return &Container{app, db}, nil
+	// Initialize the redis configuration
+	redis := &Redis{
+		Host:     getEnvValue("REDIS_HOST", "localhost"),
+		Port:     getEnvValue("REDIS_PORT", "6379"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}
+
+	// Initialize the query cache configuration
+	size, err := strconv.Atoi(getEnvValue("CACHE_SIZE", "1000"))
+	if err != nil {
+		return nil, err
+	}
+	cache := &Cache{
+		Backend: getEnvValue("CACHE_BACKEND", "memory"),
+		Size:    size,
+	}
+
+	// Initialize the http server configuration
+	httpCfg := &HTTP{
+		Addr:         getEnvValue("HTTP_ADDR", ":8080"),
+		AllowOrigins: strings.Split(getEnvValue("HTTP_ALLOW_ORIGINS", "*"), ","),
+		BodyLimit:    getEnvValue("HTTP_BODY_LIMIT", "2M"),
+	}
+	for _, d := range []struct {
+		dst *time.Duration
+		key string
+		dv  string
+	}{
+		{&httpCfg.RequestTimeout, "HTTP_REQUEST_TIMEOUT", "15s"},
+		{&httpCfg.ReadTimeout, "HTTP_READ_TIMEOUT", "10s"},
+		{&httpCfg.WriteTimeout, "HTTP_WRITE_TIMEOUT", "30s"},
+		{&httpCfg.IdleTimeout, "HTTP_IDLE_TIMEOUT", "60s"},
+	} {
+		if *d.dst, err = time.ParseDuration(getEnvValue(d.key, d.dv)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Initialize the live events configuration
+	events := &Events{Backend: getEnvValue("EVENTS_BACKEND", "local")}
+	if events.PollInterval, err = time.ParseDuration(getEnvValue("EVENTS_POLL_INTERVAL", "2s")); err != nil {
+		return nil, err
+	}
+	if events.Heartbeat, err = time.ParseDuration(getEnvValue("EVENTS_HEARTBEAT", "25s")); err != nil {
+		return nil, err
+	}
+
+	// Initialize the authentication configuration
+	ttl, err := strconv.Atoi(getEnvValue("JWT_EXPIRATION", "3600"))
+	if err != nil {
+		return nil, err
+	}
+	auth := &Auth{
+		SigningKey: os.Getenv("JWT_SECRET_KEY"),
+		Issuer:     getEnvValue("JWT_ISSUER", "gormpg"),
+		Audience:   getEnvValue("JWT_AUDIENCE", "gormpg"),
+		TokenTTL:   time.Duration(ttl) * time.Second,
+	}
+
+	return &Container{app, db, redis, cache, httpCfg, events, auth}, nil
 }
 
 // getEnvValue returns the environment variable value for key, or dv if unset or empty.
@@ -47,3 +164,20 @@ func getEnvValue(key, dv string) string {
 	}
 	return value
 }
+
+// Missing returns the names of the required environment variables that are
+// unset, none when the configuration is complete.
+func (c *Container) Missing() []string {
+	var missing []string
+	for _, v := range []struct{ key, value string }{
+		{"DB_HOST", c.DB.Host},
+		{"DB_PORT", c.DB.Port},
+		{"DB_USERNAME", c.DB.Username},
+		{"DB_NAME", c.DB.DBName},
+	} {
+		if v.value == "" {
+			missing = append(missing, v.key)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,243 @@
+// Package archive moves cold exchange history out of the hot tables.
+//
+// Exchanges that are over (completed, canceled, declined or archived) and
+// haven't changed since a cutoff are moved, with their chat threads and
+// messages, to exchanges_archive, chat_threads_archive and messages_archive;
+// so are archived chat threads of exchanges that are still going. The archive
+// tables have the same columns as the hot ones but no foreign keys. Rows
+// outside these tables that point at an exchange (its user ratings) do so
+// without a foreign key, and keep pointing at it once archived.
+//
+// Reads that need the whole history union both sides with a scope, the rows
+// come back as the usual models:
+//
+//	db.Scopes(archive.Union[models.Exchange]).
+//		Preload("ChatThreads", archive.Union[models.ChatThread]).
+//		Where("requester_id = ?", id).
+//		Find(&exchanges)
+package archive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Suffix is appended to a hot table name to get its archive table.
+const Suffix = "_archive"
+
+const DefaultBatchSize = 200
+
+// Models are the models with an archive table, parents first.
+var Models = []any{&models.Exchange{}, &models.ChatThread{}, &models.Message{}}
+
+// Migrate creates or updates the archive tables.
+func Migrate(db *gorm.DB) error {
+	// the archive keeps rows whose parents are gone from the hot tables, and
+	// constraint names are shared by the whole schema
+	cfg := *db.Config
+	cfg.DisableForeignKeyConstraintWhenMigrating = true
+	tx := db.Session(&gorm.Session{})
+	tx.Config = &cfg
+
+	for _, model := range Models {
+		table, err := tableOf(db, model)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table(table + Suffix).AutoMigrate(model); err != nil {
+			return fmt.Errorf("archive: migrating %s%s: %w", table, Suffix, err)
+		}
+	}
+	return nil
+}
+
+// Union is a scope reading T from its hot and archive tables together, under
+// the hot table's name so conditions, soft delete and preloads work as usual.
+func Union[T any](db *gorm.DB) *gorm.DB {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		db.AddError(err)
+		return db
+	}
+
+	columns := make([]string, len(stmt.Schema.DBNames))
+	for i, name := range stmt.Schema.DBNames {
+		columns[i] = stmt.Quote(name)
+	}
+	list := strings.Join(columns, ", ")
+	table := stmt.Schema.Table
+
+	return db.Model(new(T)).Table(fmt.Sprintf("(SELECT %s FROM %s UNION ALL SELECT %s FROM %s) AS %s",
+		list, stmt.Quote(table), list, stmt.Quote(table+Suffix), stmt.Quote(table)))
+}
+
+// Result counts what a run moved.
+type Result struct {
+	Exchanges int64 `json:"exchanges"`
+	Threads   int64 `json:"threads"`
+	Messages  int64 `json:"messages"`
+	Batches   int   `json:"batches"`
+}
+
+// Archiver moves cold rows to the archive tables.
+type Archiver struct {
+	db *gorm.DB
+	// BatchSize is the number of exchanges (or threads) moved per
+	// transaction.
+	BatchSize int
+}
+
+// New returns an Archiver for db.
+func New(db *gorm.DB) *Archiver {
+	return &Archiver{db: db, BatchSize: DefaultBatchSize}
+}
+
+// Run archives the exchanges over before cutoff, then the archived threads
+// untouched since cutoff. Each batch moves in its own transaction, an error
+// leaves the batches before it archived.
+func (a *Archiver) Run(ctx context.Context, cutoff time.Time) (Result, error) {
+	var r Result
+	db := a.db.WithContext(ctx)
+
+	exchanges := func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Model(&models.Exchange{}).
+			Where("status IN ? OR archived = ?", []models.Status{
+				models.ExchangeStatusCompleted,
+				models.ExchangeStatusCancelled,
+				models.ExchangeStatusDeclined,
+				models.ExchangeStatusArchived,
+			}, true).
+			Where("status_updated_at < ?", cutoff)
+	}
+	err := a.batches(ctx, db, &r, exchanges, func(tx *gorm.DB, ids []uint, r *Result) error {
+		var threadIDs []uint
+		if err := tx.Unscoped().Model(&models.ChatThread{}).Where("exchange_id IN ?", ids).Pluck("id", &threadIDs).Error; err != nil {
+			return err
+		}
+		// children first, the hot tables still have their foreign keys
+		n, err := move(tx, &models.Message{}, "thread_id", threadIDs)
+		r.Messages += n
+		if err != nil {
+			return err
+		}
+		n, err = move(tx, &models.ChatThread{}, "id", threadIDs)
+		r.Threads += n
+		if err != nil {
+			return err
+		}
+		// user_ratings.exchange_id has no foreign key, the ratings keep
+		// pointing at their exchange, now in the archive
+		n, err = move(tx, &models.Exchange{}, "id", ids)
+		r.Exchanges += n
+		return err
+	})
+	if err != nil {
+		return r, err
+	}
+
+	threads := func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Model(&models.ChatThread{}).
+			Where("archived = ? AND updated_at < ?", true, cutoff)
+	}
+	err = a.batches(ctx, db, &r, threads, func(tx *gorm.DB, ids []uint, r *Result) error {
+		n, err := move(tx, &models.Message{}, "thread_id", ids)
+		r.Messages += n
+		if err != nil {
+			return err
+		}
+		n, err = move(tx, &models.ChatThread{}, "id", ids)
+		r.Threads += n
+		return err
+	})
+	return r, err
+}
+
+// batches calls fn in a transaction for every BatchSize ids picked by query,
+// until there are none left, adding what committed batches moved to total.
+func (a *Archiver) batches(ctx context.Context, db *gorm.DB, total *Result, query func(*gorm.DB) *gorm.DB, fn func(tx *gorm.DB, ids []uint, r *Result) error) error {
+	size := a.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var ids []uint
+		var batch Result
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := query(tx).
+				Order("id").
+				Limit(size).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			return fn(tx, ids, &batch)
+		})
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			total.Exchanges += batch.Exchanges
+			total.Threads += batch.Threads
+			total.Messages += batch.Messages
+			total.Batches++
+		}
+		// the moved rows are gone from the query, the next batch starts over
+		if len(ids) < size {
+			return nil
+		}
+	}
+}
+
+// move copies the rows of model whose column is in values to the archive
+// table and deletes them from the hot one.
+func move(tx *gorm.DB, model any, column string, values []uint) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	columns := make([]string, len(stmt.Schema.DBNames))
+	for i, name := range stmt.Schema.DBNames {
+		columns[i] = stmt.Quote(name)
+	}
+	list := strings.Join(columns, ", ")
+	table := stmt.Schema.Table
+
+	// explicit columns, the hot table may have grown them in another order
+	if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IN ?",
+		stmt.Quote(table+Suffix), list, list, stmt.Quote(table), stmt.Quote(column)), values).Error; err != nil {
+		return 0, fmt.Errorf("archive: copying %s: %w", table, err)
+	}
+
+	// Unscoped: trashed rows move too, and are hard deleted from the hot table
+	res := tx.Unscoped().Where(fmt.Sprintf("%s IN ?", stmt.Quote(column)), values).Delete(model)
+	if res.Error != nil {
+		return 0, fmt.Errorf("archive: deleting %s: %w", table, res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+func tableOf(db *gorm.DB, model any) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
@@ -0,0 +1,97 @@
+// Package cache caches the results of read queries and drops them when the
+// tables they were read from are written to.
+//
+// Only queries that ask for it are cached, through the Cached scope:
+//
+//	db.Scopes(cache.Cached(5*time.Minute, "book_reviews")).
+//		Model(&models.Book{}).
+//		Select("books.id, (?) AS avg_review", reviews).
+//		Find(&results)
+//
+// The key is derived from the SQL with its vars and the type results are read
+// into. An entry is tagged with the table of the query and the extra tables
+// given to Cached (joins, sub queries); creating, updating or deleting rows of
+// a table through gorm invalidates every entry tagged with it. Raw Exec
+// statements don't, callers writing that way call Plugin.Invalidate.
+//
+// Invalidation happens when the statement runs and again once the
+// txmanager unit carrying it commits, a reader can't cache the old rows for
+// longer than that. Writes in plain db.Transaction calls only get the first,
+// the TTL bounds how stale such an entry gets. Queries in a transaction
+// neither read nor fill the cache, they may see writes that are rolled back.
+//
+// Results are gob encoded, json:"-" fields (a user's password hash) survive
+// the round trip. Only Find, First, Take and Last go through the cache: Scan,
+// Pluck and Count read through the row callbacks.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// ErrMiss is returned by a Store that has no entry for a key.
+var ErrMiss = errors.New("cache: miss")
+
+// Store is a cache backend.
+type Store interface {
+	// Get returns the value stored under key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key for ttl, tagged with tags.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error
+	// Invalidate drops every entry tagged with one of tags.
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// settingKey holds the options of a cached query in the statement settings.
+const settingKey = "cache:options"
+
+type options struct {
+	ttl  time.Duration
+	tags []string
+}
+
+// Cached is a scope caching the query for ttl. The query's own table is
+// always a tag, tables lists the other tables it reads from.
+func Cached(ttl time.Duration, tables ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(settingKey, options{ttl: ttl, tags: tables})
+	}
+}
+
+// key identifies the result of a statement whose SQL has been built.
+func key(stmt *gorm.Statement) string {
+	sum := sha256.New()
+	// the same rows read into another type are another entry
+	fmt.Fprintf(sum, "%s\n", reflect.TypeOf(stmt.Dest))
+	sum.Write([]byte(stmt.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// New returns the Store configured by cfg.
+func New(ctx context.Context, cfg *config.Container) (Store, error) {
+	switch cfg.Cache.Backend {
+	case "memory":
+		return NewLRU(cfg.Cache.Size), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     net.JoinHostPort(cfg.Redis.Host, cfg.Redis.Port),
+			Password: cfg.Redis.Password,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("cache: connecting to redis: %w", err)
+		}
+		return NewRedis(client, "gormpg:cache:"), nil
+	}
+	return nil, fmt.Errorf("cache: unknown backend %q", cfg.Cache.Backend)
+}
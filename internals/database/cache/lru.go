@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Store keeping at most a fixed number of entries, the
+// least recently used going first.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[string]*list.Element
+	tagged  map[string]map[string]struct{}
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	tags    []string
+	expires time.Time
+}
+
+// NewLRU returns an LRU holding up to size entries.
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = 1
+	}
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		tagged:  map[string]map[string]struct{}{},
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, ErrMiss
+	}
+	c.order.MoveToFront(el)
+	return e.value, nil
+}
+
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	e := &lruEntry{key: key, value: value, tags: tags, expires: c.now().Add(ttl)}
+	c.entries[key] = c.order.PushFront(e)
+	for _, tag := range tags {
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = map[string]struct{}{}
+		}
+		c.tagged[tag][key] = struct{}{}
+	}
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Invalidate(_ context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range c.tagged[tag] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+			}
+		}
+		delete(c.tagged, tag)
+	}
+	return nil
+}
+
+// Len returns the number of entries, expired ones included.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.key)
+	for _, tag := range e.tags {
+		delete(c.tagged[tag], e.key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+}
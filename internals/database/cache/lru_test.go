@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), time.Minute, nil)
+	c.Set(ctx, "b", []byte("2"), time.Minute, nil)
+	// a is now more recent than b
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	c.Set(ctx, "c", []byte("3"), time.Minute, nil)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(b) = %v, want ErrMiss: it was the least recently used", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Errorf("Get(%s): %v", key, err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Set(ctx, "a", []byte("1"), time.Minute, nil)
+
+	now = now.Add(59 * time.Second)
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Errorf("Get before the ttl: %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get after the ttl = %v, want ErrMiss", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, the expired entry is kept", c.Len())
+	}
+}
+
+func TestLRUInvalidate(t *testing.T) {
+	testInvalidate(t, NewLRU(10))
+}
+
+// testInvalidate checks that store drops the entries of the invalidated
+// tags, and only those.
+func testInvalidate(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	store.Set(ctx, "books", []byte("1"), time.Minute, []string{"books"})
+	store.Set(ctx, "joined", []byte("2"), time.Minute, []string{"books", "book_reviews"})
+	store.Set(ctx, "users", []byte("3"), time.Minute, []string{"users"})
+
+	if err := store.Invalidate(ctx, "book_reviews"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "joined"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(joined) after invalidating book_reviews = %v, want ErrMiss", err)
+	}
+	if _, err := store.Get(ctx, "books"); err != nil {
+		t.Errorf("Get(books) after invalidating book_reviews: %v", err)
+	}
+
+	if err := store.Invalidate(ctx, "books"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "books"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(books) after invalidating books = %v, want ErrMiss", err)
+	}
+	if v, err := store.Get(ctx, "users"); err != nil || string(v) != "3" {
+		t.Errorf("Get(users) = %q, %v; want it untouched", v, err)
+	}
+
+	// a tag can be used again once invalidated
+	store.Set(ctx, "books", []byte("4"), time.Minute, []string{"books"})
+	if v, err := store.Get(ctx, "books"); err != nil || string(v) != "4" {
+		t.Errorf("Get(books) after setting it again = %q, %v", v, err)
+	}
+}
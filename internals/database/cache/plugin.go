@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"reflect"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// Plugin serves the Cached queries from Store and invalidates its entries on
+// writes:
+//
+//	db.Use(&cache.Plugin{Store: cache.NewLRU(1000)})
+//
+// A failing Store never fails a query, the error is logged and the query
+// runs against the database.
+type Plugin struct {
+	Store Store
+}
+
+func (p *Plugin) Name() string { return "cache" }
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	if p.Store == nil {
+		return errors.New("cache: plugin without a Store")
+	}
+	cb := db.Callback()
+	query := cb.Query().Get("gorm:query")
+	if query == nil {
+		return errors.New("cache: gorm:query callback not registered")
+	}
+	if err := cb.Query().Replace("gorm:query", p.query(query)); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("cache:invalidate", p.invalidate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("cache:invalidate", p.invalidate); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("cache:invalidate", p.invalidate)
+}
+
+// Invalidate drops the entries read from tables, for writes that don't go
+// through the gorm callbacks.
+func (p *Plugin) Invalidate(ctx context.Context, tables ...string) error {
+	return p.Store.Invalidate(ctx, tables...)
+}
+
+// query wraps the gorm:query callback next.
+func (p *Plugin) query(next func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.Get(settingKey)
+		dest := reflect.ValueOf(db.Statement.Dest)
+		if !ok || db.Error != nil || db.DryRun || dest.Kind() != reflect.Pointer || dest.IsNil() || inTransaction(db) {
+			next(db)
+			return
+		}
+		opts := v.(options)
+
+		// next doesn't build it again
+		callbacks.BuildQuerySQL(db)
+		if db.Error != nil {
+			return
+		}
+		ctx := db.Statement.Context
+		k := key(db.Statement)
+
+		data, err := p.Store.Get(ctx, k)
+		if err == nil {
+			// start from scratch, gob leaves the fields it has no value for
+			dest.Elem().Set(reflect.Zero(dest.Elem().Type()))
+			rows, err := decode(data, db.Statement.Dest)
+			if err == nil {
+				db.RowsAffected = rows
+				if rows == 0 && db.Statement.RaiseErrorOnNotFound {
+					db.AddError(gorm.ErrRecordNotFound)
+				}
+				return
+			}
+			db.Logger.Warn(ctx, "cache: decoding %s: %v", k, err)
+		} else if !errors.Is(err, ErrMiss) {
+			db.Logger.Warn(ctx, "cache: get: %v", err)
+		}
+
+		next(db)
+		if db.Error != nil {
+			return
+		}
+		data, err = encode(db.RowsAffected, db.Statement.Dest)
+		if err != nil {
+			db.Logger.Warn(ctx, "cache: encoding %T: %v", db.Statement.Dest, err)
+			return
+		}
+		tags := append([]string{tableOf(db.Statement)}, opts.tags...)
+		if err := p.Store.Set(ctx, k, data, opts.ttl, tags); err != nil {
+			db.Logger.Warn(ctx, "cache: set: %v", err)
+		}
+	}
+}
+
+// inTransaction tells whether db runs in a transaction. Its reads go to the
+// database: they may see its own uncommitted writes, which a rollback
+// leaves cached with nothing to invalidate them.
+func inTransaction(db *gorm.DB) bool {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return true
+	}
+	_, ok := txmanager.FromContext(db.Statement.Context)
+	return ok
+}
+
+func (p *Plugin) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 {
+		return
+	}
+	table := tableOf(db.Statement)
+	if table == "" {
+		return
+	}
+
+	drop := func(ctx context.Context) {
+		if err := p.Store.Invalidate(ctx, table); err != nil {
+			db.Logger.Error(ctx, "cache: invalidating %s: %v", table, err)
+		}
+	}
+	ctx := db.Statement.Context
+	drop(ctx)
+	// a reader may have cached the rows the transaction is replacing in the
+	// meantime
+	if _, ok := txmanager.FromContext(ctx); ok {
+		txmanager.AfterCommit(ctx, drop)
+	}
+}
+
+// tableOf returns the table the statement is about; the schema's table when
+// there is one, Table may be a sub query (see archive.Union).
+func tableOf(stmt *gorm.Statement) string {
+	if stmt.Schema != nil {
+		return stmt.Schema.Table
+	}
+	return stmt.Table
+}
+
+func encode(rows int64, dest any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(rows); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(dest); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, dest any) (int64, error) {
+	var rows int64
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&rows); err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		// gob has nothing to say about an empty value
+		return 0, nil
+	}
+	return rows, dec.Decode(dest)
+}
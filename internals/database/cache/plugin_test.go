@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type book struct {
+	ID    uint
+	Title string
+}
+
+type review struct {
+	ID     uint
+	BookID uint
+	Rating int
+}
+
+type user struct {
+	ID   uint
+	Name string
+}
+
+// openCached returns an in-memory database with the plugin on an LRU, and
+// a book with a review.
+func openCached(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&book{}, &review{}, &user{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&Plugin{Store: NewLRU(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&book{ID: 1, Title: "Dune"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&review{ID: 1, BookID: 1, Rating: 5}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// titles reads the titles of the books rated 4 or more, cached and tagged
+// with reviews.
+func titles(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var books []book
+	if err := db.Scopes(Cached(time.Minute, "reviews")).
+		Where("id IN (?)", db.Model(&review{}).Select("book_id").Where("rating >= 4")).
+		Order("id").
+		Find(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	titles := make([]string, len(books))
+	for i, b := range books {
+		titles[i] = b.Title
+	}
+	return titles
+}
+
+// sneak changes the rows with a raw statement, which doesn't invalidate:
+// what titles reads afterwards tells whether it came from the cache.
+func sneak(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	if err := db.Exec("UPDATE books SET title = title || '*'").Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPluginServesFromCache(t *testing.T) {
+	db := openCached(t)
+	if got := titles(t, db); len(got) != 1 || got[0] != "Dune" {
+		t.Fatalf("titles = %v, want [Dune]", got)
+	}
+	sneak(t, db)
+	if got := titles(t, db); len(got) != 1 || got[0] != "Dune" {
+		t.Errorf("titles = %v, want the cached [Dune]", got)
+	}
+	// a write to a table the query doesn't read keeps the entry
+	if err := db.Create(&user{Name: "jane"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, db); len(got) != 1 || got[0] != "Dune" {
+		t.Errorf("titles = %v after writing users, want the cached [Dune]", got)
+	}
+}
+
+func TestPluginInvalidates(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write func(*gorm.DB) error
+		want  []string
+	}{
+		{"create of the query's table", func(db *gorm.DB) error {
+			if err := db.Create(&book{ID: 2, Title: "Emma"}).Error; err != nil {
+				return err
+			}
+			return db.Create(&review{BookID: 2, Rating: 4}).Error
+		}, []string{"Dune*", "Emma"}},
+		{"update of the query's table", func(db *gorm.DB) error {
+			return db.Model(&book{ID: 1}).Update("title", "Dune Messiah").Error
+		}, []string{"Dune Messiah"}},
+		{"delete of the query's table", func(db *gorm.DB) error {
+			return db.Delete(&book{ID: 1}).Error
+		}, []string{}},
+		{"create of a tagged table", func(db *gorm.DB) error {
+			return db.Create(&review{BookID: 1, Rating: 1}).Error
+		}, []string{"Dune*"}},
+		{"update of a tagged table", func(db *gorm.DB) error {
+			return db.Model(&review{ID: 1}).Update("rating", 1).Error
+		}, []string{}},
+		{"delete of a tagged table", func(db *gorm.DB) error {
+			return db.Delete(&review{ID: 1}).Error
+		}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openCached(t)
+			titles(t, db)
+			sneak(t, db)
+			if err := tc.write(db); err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(t, db); !slices.Equal(got, tc.want) {
+				t.Errorf("titles = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPluginSkipsRolledBackReads(t *testing.T) {
+	rollback := errors.New("rollback")
+	for _, tc := range []struct {
+		name string
+		tx   func(db *gorm.DB, fn func(*gorm.DB) error) error
+	}{
+		{"db.Transaction", func(db *gorm.DB, fn func(*gorm.DB) error) error {
+			return db.Transaction(fn)
+		}},
+		{"txmanager unit", func(db *gorm.DB, fn func(*gorm.DB) error) error {
+			tm := txmanager.New(db, txmanager.NoRetry())
+			return tm.Do(context.Background(), func(ctx context.Context) error {
+				return fn(tm.DB(ctx))
+			})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openCached(t)
+			err := tc.tx(db, func(tx *gorm.DB) error {
+				if err := tx.Create(&book{ID: 2, Title: "Ghost"}).Error; err != nil {
+					return err
+				}
+				if err := tx.Create(&review{BookID: 2, Rating: 5}).Error; err != nil {
+					return err
+				}
+				// sees the uncommitted book, it mustn't be cached
+				if got := titles(t, tx); !slices.Equal(got, []string{"Dune", "Ghost"}) {
+					t.Errorf("titles in the transaction = %v, want [Dune Ghost]", got)
+				}
+				return rollback
+			})
+			if !errors.Is(err, rollback) {
+				t.Fatalf("transaction: %v, want the rollback", err)
+			}
+			if got := titles(t, db); !slices.Equal(got, []string{"Dune"}) {
+				t.Errorf("titles after the rollback = %v, want [Dune]", got)
+			}
+		})
+	}
+}
+
+func TestPluginInvalidateByHand(t *testing.T) {
+	db := openCached(t)
+	titles(t, db)
+	sneak(t, db)
+	if err := db.Config.Plugins["cache"].(*Plugin).Invalidate(db.Statement.Context, "books"); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, db); len(got) != 1 || got[0] != "Dune*" {
+		t.Errorf("titles = %v after Invalidate, want [Dune*]", got)
+	}
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Store shared by every instance of the application. Each tag is
+// a set of the keys tagged with it; the sets don't expire, Invalidate empties
+// them, so a set only collects the names of expired entries until the next
+// write to its table.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis returns a Redis store keeping its keys under prefix.
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) entryKey(key string) string { return r.prefix + "entry:" + key }
+func (r *Redis) tagKey(tag string) string   { return r.prefix + "tag:" + tag }
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, r.entryKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.entryKey(key), value, ttl)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, r.tagKey(tag), r.entryKey(key))
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		// pop the set: an entry tagged after this doesn't hold old rows
+		var members *redis.StringSliceCmd
+		if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			members = pipe.SMembers(ctx, r.tagKey(tag))
+			pipe.Del(ctx, r.tagKey(tag))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if keys := members.Val(); len(keys) > 0 {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedis returns a Redis store on an in-process Redis server.
+func newRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedis(client, "test:"), server
+}
+
+func TestRedisGetSet(t *testing.T) {
+	ctx := context.Background()
+	store, server := newRedis(t)
+
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get of a missing key = %v, want ErrMiss", err)
+	}
+	if err := store.Set(ctx, "a", []byte("value"), time.Minute, []string{"books"}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.Get(ctx, "a")
+	if err != nil || string(v) != "value" {
+		t.Errorf("Get = %q, %v; want value", v, err)
+	}
+	if !server.Exists("test:entry:a") {
+		t.Error("the entry isn't stored under the prefix")
+	}
+	if ok, _ := server.SIsMember("test:tag:books", "test:entry:a"); !ok {
+		t.Error("the entry isn't in the set of its tag")
+	}
+
+	server.FastForward(time.Minute)
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get after the ttl = %v, want ErrMiss", err)
+	}
+}
+
+func TestRedisInvalidate(t *testing.T) {
+	store, server := newRedis(t)
+	testInvalidate(t, store)
+	if server.Exists("test:tag:book_reviews") {
+		t.Error("the set of an invalidated tag is kept")
+	}
+}
@@ -0,0 +1,195 @@
+// Package counter keeps denormalised counts (a user's books, a book's
+// reviews, ...) in the parent rows, so lists can show and sort by them
+// without a GROUP BY join.
+//
+// A Counter says which child rows are counted in which parent column. The
+// Plugin adjusts the column in the transaction of every create, update and
+// delete of children going through gorm, bulk and soft deletes included
+// (restoring a row counts it again):
+//
+//	db.Use(counter.Plugin{Counters: counter.Defaults()})
+//
+// It works out what a statement changed by aggregating the affected child
+// rows per parent before and after it runs, and adds the difference to the
+// parents, so it holds for any statement touching the key or summed column
+// of a counted table. What goes around gorm (raw Exec, the database's own ON
+// DELETE CASCADE, upserts counting a row that already existed) drifts the
+// counts; Reconcile recomputes them from the children and fixes the drift.
+//
+// Only live children count: with a soft delete, trashed rows are left out.
+package counter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Counter keeps Parent.Column equal to the number of Child rows pointing at
+// the parent, or to the sum of their Sum column.
+type Counter struct {
+	// Name identifies the counter in errors and reconcile reports.
+	Name   string
+	Child  any
+	Parent any
+	// Key is the child column holding the parent's id.
+	Key string
+	// Through is set when the parent is two hops away: Key then holds the id
+	// of a row of another table whose Through column (table.column) holds
+	// the parent's id.
+	Through string
+	// Column is the parent column holding the count.
+	Column string
+	// Sum is the child column added up, rows are counted when empty.
+	Sum string
+}
+
+// Defaults are the counters of the application.
+func Defaults() []Counter {
+	return []Counter{
+		{Name: "users.books_count", Child: &models.Book{}, Key: "owner_id", Parent: &models.User{}, Column: "books_count"},
+		{Name: "books.reviews_count", Child: &models.BookReview{}, Key: "book_id", Parent: &models.Book{}, Column: "reviews_count"},
+		{Name: "books.rating_sum", Child: &models.BookReview{}, Key: "book_id", Parent: &models.Book{}, Column: "rating_sum", Sum: "rating"},
+		{Name: "communities.members_count", Child: &models.CommunityMember{}, Key: "community_id", Parent: &models.Community{}, Column: "members_count"},
+		{Name: "communities.messages_count", Child: &models.CommunityMessage{}, Key: "thread_id", Through: "community_threads.community_id", Parent: &models.Community{}, Column: "messages_count"},
+		{Name: "community_threads.messages_count", Child: &models.CommunityMessage{}, Key: "thread_id", Parent: &models.CommunityThread{}, Column: "messages_count"},
+	}
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// counter is a Counter with its schemas parsed.
+type counter struct {
+	Counter
+	child, parent *schema.Schema
+	childPK       string
+	parentPK      string
+	// deletedAt is the child's soft delete column, if any
+	deletedAt string
+	// watched are the child columns whose change moves the count
+	watched map[string]bool
+}
+
+func parse(db *gorm.DB, c Counter) (*counter, error) {
+	child, err := schemaOf(db, c.Child)
+	if err != nil {
+		return nil, fmt.Errorf("counter %s: %w", c.Name, err)
+	}
+	parent, err := schemaOf(db, c.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("counter %s: %w", c.Name, err)
+	}
+	if len(child.PrimaryFields) != 1 || len(parent.PrimaryFields) != 1 {
+		return nil, fmt.Errorf("counter %s: child and parent need a single primary key", c.Name)
+	}
+	if _, _, ok := strings.Cut(c.Through, "."); c.Through != "" && !ok {
+		return nil, fmt.Errorf("counter %s: Through must be table.column", c.Name)
+	}
+	if parent.LookUpField(c.Column) == nil {
+		return nil, fmt.Errorf("counter %s: %s has no column %s", c.Name, parent.Table, c.Column)
+	}
+
+	p := &counter{
+		Counter:  c,
+		child:    child,
+		parent:   parent,
+		childPK:  child.PrimaryFields[0].DBName,
+		parentPK: parent.PrimaryFields[0].DBName,
+		watched:  map[string]bool{},
+	}
+	for _, name := range []string{c.Key, c.Sum} {
+		if name == "" {
+			continue
+		}
+		f := child.LookUpField(name)
+		if f == nil {
+			return nil, fmt.Errorf("counter %s: %s has no column %s", c.Name, child.Table, name)
+		}
+		p.watched[f.DBName] = true
+	}
+	for _, f := range child.Fields {
+		if f.FieldType == deletedAtType && f.DBName != "" {
+			p.deletedAt = f.DBName
+			p.watched[f.DBName] = true
+		}
+	}
+	return p, nil
+}
+
+func schemaOf(db *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// key is the SQL giving the parent id of a child row.
+func (c *counter) key() string {
+	key := c.child.Table + "." + c.Key
+	if c.Through == "" {
+		return key
+	}
+	table, column, _ := strings.Cut(c.Through, ".")
+	return fmt.Sprintf("(SELECT %s.%s FROM %s WHERE %s.id = %s)", table, column, table, table, key)
+}
+
+// aggregate is the SQL computing the counter over a group of child rows.
+func (c *counter) aggregate() string {
+	if c.Sum == "" {
+		return "COUNT(*)"
+	}
+	return fmt.Sprintf("COALESCE(SUM(%s.%s), 0)", c.child.Table, c.Sum)
+}
+
+// live narrows q to the child rows that count.
+func (c *counter) live(q *gorm.DB) *gorm.DB {
+	q = q.Unscoped()
+	if c.deletedAt != "" {
+		q = q.Where(clause.Eq{Column: clause.Column{Table: c.child.Table, Name: c.deletedAt}, Value: nil})
+	}
+	return q
+}
+
+// totals returns the counter per parent over the child rows with the given
+// ids.
+func (c *counter) totals(tx *gorm.DB, ids []any) (map[uint]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var rows []struct {
+		ParentID *uint
+		Total    int64
+	}
+	err := c.live(tx.Table(c.child.Table)).
+		Select(c.key() + " AS parent_id, " + c.aggregate() + " AS total").
+		Where(clause.IN{Column: clause.Column{Table: c.child.Table, Name: c.childPK}, Values: ids}).
+		Group("parent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		if r.ParentID != nil {
+			totals[*r.ParentID] = r.Total
+		}
+	}
+	return totals, nil
+}
+
+// add adds delta to the counter of parent.
+func (c *counter) add(tx *gorm.DB, parent uint, delta int64) error {
+	column := clause.Column{Name: c.Column}
+	// signed: the columns are unsigned, a count that drifted to 0 mustn't
+	// fail the write
+	return tx.Table(c.parent.Table).
+		Where(clause.Eq{Column: clause.Column{Name: c.parentPK}, Value: parent}).
+		UpdateColumn(c.Column, gorm.Expr("CASE WHEN CAST(? AS SIGNED) + ? > 0 THEN CAST(? AS SIGNED) + ? ELSE 0 END", column, delta, column, delta)).Error
+}
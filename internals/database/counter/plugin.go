@@ -0,0 +1,257 @@
+package counter
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// beforeKey holds the totals of the affected rows before an update or delete.
+const beforeKey = "counter:before"
+
+// Plugin maintains Counters:
+//
+//	db.Use(counter.Plugin{Counters: counter.Defaults()})
+type Plugin struct {
+	Counters []Counter
+}
+
+func (Plugin) Name() string { return "counter" }
+
+func (p Plugin) Initialize(db *gorm.DB) error {
+	// counters by child table
+	byTable := map[string][]*counter{}
+	for _, c := range p.Counters {
+		parsed, err := parse(db, c)
+		if err != nil {
+			return err
+		}
+		byTable[parsed.child.Table] = append(byTable[parsed.child.Table], parsed)
+	}
+	h := &hooks{byTable: byTable}
+
+	// inside the statement's transaction, before it commits
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("counter:after_create", h.afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:begin_transaction").Before("gorm:update").Register("counter:before_update", h.beforeUpdate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("counter:after_update", h.after); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:begin_transaction").Before("gorm:delete").Register("counter:before_delete", h.beforeDelete); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("counter:after_delete", h.after)
+}
+
+type hooks struct {
+	byTable map[string][]*counter
+}
+
+// snapshot is the state of the rows a statement touches before it runs.
+type snapshot struct {
+	ids    []any
+	totals []map[uint]int64 // per counter
+}
+
+func (h *hooks) counters(db *gorm.DB) []*counter {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil {
+		return nil
+	}
+	return h.byTable[db.Statement.Schema.Table]
+}
+
+func (h *hooks) afterCreate(db *gorm.DB) {
+	counters := h.counters(db)
+	if len(counters) == 0 || db.RowsAffected == 0 {
+		return
+	}
+	ids := primaryKeys(db.Statement, db.Statement.ReflectValue)
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for _, c := range counters {
+		after, err := c.totals(tx, ids)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		if err := c.apply(tx, nil, after); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+}
+
+func (h *hooks) beforeUpdate(db *gorm.DB) {
+	counters := h.counters(db)
+	if len(counters) == 0 || !touchesWatched(db.Statement, counters) {
+		return
+	}
+	h.before(db, counters)
+}
+
+func (h *hooks) beforeDelete(db *gorm.DB) {
+	if counters := h.counters(db); len(counters) > 0 {
+		h.before(db, counters)
+	}
+}
+
+// before records the counters over the rows an update or delete is about to
+// touch.
+func (h *hooks) before(db *gorm.DB, counters []*counter) {
+	ids, ok := affected(db)
+	if !ok || len(ids) == 0 {
+		return
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	s := &snapshot{ids: ids, totals: make([]map[uint]int64, len(counters))}
+	for i, c := range counters {
+		totals, err := c.totals(tx, ids)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		s.totals[i] = totals
+	}
+	db.InstanceSet(beforeKey, s)
+}
+
+// after adds what the update or delete changed to the parents.
+func (h *hooks) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(beforeKey)
+	if !ok || db.Error != nil || db.RowsAffected == 0 {
+		return
+	}
+	s := v.(*snapshot)
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for i, c := range h.counters(db) {
+		after, err := c.totals(tx, s.ids)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		if err := c.apply(tx, s.totals[i], after); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+}
+
+// apply adds after - before to the parents' counters.
+func (c *counter) apply(tx *gorm.DB, before, after map[uint]int64) error {
+	deltas := map[uint]int64{}
+	for id, n := range after {
+		deltas[id] += n
+	}
+	for id, n := range before {
+		deltas[id] -= n
+	}
+	// in id order, two transactions touching the same parents lock them in
+	// the same order
+	for _, id := range slices.Sorted(maps.Keys(deltas)) {
+		if deltas[id] == 0 {
+			continue
+		}
+		if err := c.add(tx, id, deltas[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touchesWatched tells whether an update may change a watched column.
+func touchesWatched(stmt *gorm.Statement, counters []*counter) bool {
+	watched := func(name string) bool {
+		if f := stmt.Schema.LookUpField(name); f != nil {
+			name = f.DBName
+		}
+		for _, c := range counters {
+			if c.watched[name] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var columns map[string]any
+	switch dest := stmt.Dest.(type) {
+	case map[string]any:
+		columns = dest
+	case *map[string]any:
+		columns = *dest
+	default:
+		// a struct: the selected columns, or any of them
+		if len(stmt.Selects) == 0 {
+			return true
+		}
+		for _, name := range stmt.Selects {
+			if name == "*" || watched(name) {
+				return true
+			}
+		}
+		return false
+	}
+	for name := range columns {
+		if watched(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// affected returns the primary keys of the rows the statement will touch:
+// its conditions, and the primary key of the row it was given, under the
+// same soft delete scope. ok is false when there are no conditions, gorm
+// refuses the statement then anyway.
+func affected(db *gorm.DB) (ids []any, ok bool) {
+	stmt := db.Statement
+	q := db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		q = q.Unscoped()
+	}
+	narrowed := false
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		q = q.Clauses(where)
+		narrowed = true
+	}
+	if pks := primaryKeys(stmt, stmt.ReflectValue); len(pks) > 0 {
+		q = q.Where(clause.IN{Column: clause.PrimaryColumn, Values: pks})
+		narrowed = true
+	}
+	if !narrowed && !stmt.AllowGlobalUpdate {
+		return nil, false
+	}
+
+	var found []uint
+	if err := q.Pluck(stmt.Schema.PrimaryFields[0].DBName, &found).Error; err != nil {
+		db.AddError(err)
+		return nil, false
+	}
+	ids = make([]any, len(found))
+	for i, id := range found {
+		ids[i] = id
+	}
+	return ids, true
+}
+
+func primaryKeys(stmt *gorm.Statement, value reflect.Value) []any {
+	switch value.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+	default:
+		return nil
+	}
+	_, values := schema.GetIdentityFieldValuesMap(stmt.Context, value, stmt.Schema.PrimaryFields)
+	ids := make([]any, 0, len(values))
+	for _, v := range values {
+		if len(v) == 1 {
+			ids = append(ids, v[0])
+		}
+	}
+	return ids
+}
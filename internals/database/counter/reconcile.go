@@ -0,0 +1,85 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Drift is a parent whose counter doesn't match its children.
+type Drift struct {
+	Counter string `json:"counter"`
+	ID      uint   `json:"id"`
+	Stored  int64  `json:"stored"`
+	Actual  int64  `json:"actual"`
+}
+
+// Reconcile recomputes counters from the children and returns the parents
+// that had drifted, fixing them unless dryRun. Each parent is fixed on its
+// own, from a count taken in the same statement, so writes going on in the
+// meantime aren't lost.
+func Reconcile(ctx context.Context, db *gorm.DB, dryRun bool, counters ...Counter) ([]Drift, error) {
+	db = db.WithContext(ctx)
+
+	var drifts []Drift
+	for _, c := range counters {
+		parsed, err := parse(db, c)
+		if err != nil {
+			return drifts, err
+		}
+		found, err := parsed.drifts(db)
+		if err != nil {
+			return drifts, fmt.Errorf("counter %s: %w", c.Name, err)
+		}
+		drifts = append(drifts, found...)
+		if dryRun {
+			continue
+		}
+		for _, d := range found {
+			if err := parsed.fix(db, d.ID); err != nil {
+				return drifts, fmt.Errorf("counter %s: fixing %s %d: %w", c.Name, parsed.parent.Table, d.ID, err)
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// actual is the query computing the counter of the parent with the given id
+// (a value, or a column of an outer query).
+func (c *counter) actual(db *gorm.DB, parentID any) *gorm.DB {
+	return c.live(db.Session(&gorm.Session{NewDB: true}).Table(c.child.Table)).
+		Select(c.aggregate()).
+		Where(c.key()+" = ?", parentID)
+}
+
+func (c *counter) drifts(db *gorm.DB) ([]Drift, error) {
+	parent := clause.Column{Table: "p", Name: c.parentPK}
+	var rows []struct {
+		ID     uint
+		Stored int64
+		Actual int64
+	}
+	err := db.Table("(?) AS d", db.Table(c.parent.Table+" AS p").
+		Select("? AS id, ? AS stored, (?) AS actual", parent, clause.Column{Table: "p", Name: c.Column}, c.actual(db, parent))).
+		Where("stored <> actual").
+		Order("id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]Drift, len(rows))
+	for i, r := range rows {
+		drifts[i] = Drift{Counter: c.Name, ID: r.ID, Stored: r.Stored, Actual: r.Actual}
+	}
+	return drifts, nil
+}
+
+func (c *counter) fix(db *gorm.DB, id uint) error {
+	// through the callbacks: the query cache drops what read the old value
+	return db.Table(c.parent.Table).
+		Where(clause.Eq{Column: clause.Column{Name: c.parentPK}, Value: id}).
+		UpdateColumn(c.Column, gorm.Expr("(?)", c.actual(db, id))).Error
+}
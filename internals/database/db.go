@@ -5,6 +5,9 @@ import (
 	"os"
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/counter"
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -43,6 +46,22 @@ func ConnectDB(dsn string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// typed duplicate/foreign key/check/not found errors instead of raw
+	// driver errors, see dberrors
+	if err := db.Use(dberrors.Plugin{}); err != nil {
+		return nil, err
+	}
+	// version checked updates for models with an optlock.Version
+	if err := db.Use(optlock.Plugin{}); err != nil {
+		return nil, err
+	}
+
+	// denormalised counts (users.books_count, ...) kept in step with their
+	// children, see counter
+	if err := db.Use(counter.Plugin{Counters: counter.Defaults()}); err != nil {
+		return nil, err
+	}
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
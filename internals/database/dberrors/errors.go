@@ -0,0 +1,111 @@
+// Package dberrors translates MySQL/MariaDB and Postgres driver errors into
+// typed domain errors, so callers can tell a duplicate email from a missing
+// foreign key without parsing driver messages:
+//
+//	var dup *dberrors.ErrDuplicate
+//	if errors.As(err, &dup) && dup.Field == "email" { ... }
+//
+// The typed errors still unwrap to the driver error and match the matching
+// gorm sentinel (gorm.ErrDuplicatedKey, gorm.ErrRecordNotFound, ...) with
+// errors.Is, so existing checks keep working.
+package dberrors
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrDuplicate is a unique index or constraint violation.
+type ErrDuplicate struct {
+	// Constraint is the index or constraint name, e.g. idx_owner_title.
+	Constraint string
+	// Field is the column, or comma separated columns, the constraint is
+	// on, e.g. owner_id,title. Empty when it can't be told.
+	Field string
+	// Value is the conflicting value as reported by the database.
+	Value string
+	Err   error
+}
+
+func (e *ErrDuplicate) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("duplicate value %q for %s", e.Value, e.Field)
+	}
+	return fmt.Sprintf("duplicate value %q for %s", e.Value, e.Constraint)
+}
+
+func (e *ErrDuplicate) Unwrap() error { return e.Err }
+
+func (e *ErrDuplicate) Is(target error) bool { return target == gorm.ErrDuplicatedKey }
+
+// ErrForeignKey is a foreign key violation: either the referenced row doesn't
+// exist, or a referenced row can't be deleted because children point at it.
+type ErrForeignKey struct {
+	Constraint string
+	// Field is the referencing column, e.g. owner_id.
+	Field string
+	// Table is the referenced (parent) table when known.
+	Table string
+	Err   error
+}
+
+func (e *ErrForeignKey) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s references a missing or still referenced row (%s)", e.Field, e.Constraint)
+	}
+	return fmt.Sprintf("foreign key constraint %s failed", e.Constraint)
+}
+
+func (e *ErrForeignKey) Unwrap() error { return e.Err }
+
+func (e *ErrForeignKey) Is(target error) bool { return target == gorm.ErrForeignKeyViolated }
+
+// ErrCheck is a CHECK constraint violation, e.g. a BookReview rating of 6.
+type ErrCheck struct {
+	Constraint string
+	// Field is the column the check is declared on when known.
+	Field string
+	Err   error
+}
+
+func (e *ErrCheck) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid value for %s (%s)", e.Field, e.Constraint)
+	}
+	return fmt.Sprintf("check constraint %s failed", e.Constraint)
+}
+
+func (e *ErrCheck) Unwrap() error { return e.Err }
+
+func (e *ErrCheck) Is(target error) bool { return target == gorm.ErrCheckConstraintViolated }
+
+// ErrNotFound is returned when a single record was asked for and none
+// matched.
+type ErrNotFound struct {
+	// Entity is the model name, e.g. User.
+	Entity string
+}
+
+func (e *ErrNotFound) Error() string {
+	if e.Entity == "" {
+		return "record not found"
+	}
+	return e.Entity + " not found"
+}
+
+func (e *ErrNotFound) Unwrap() error { return gorm.ErrRecordNotFound }
+
+// ErrConflict is an optimistic locking failure: the row was updated, or
+// deleted, by someone else since it was read. Reload it and try again.
+type ErrConflict struct {
+	// Entity is the model name, e.g. Exchange.
+	Entity string
+	ID     any
+	// Version is the version the update expected to find.
+	Version uint
+}
+
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("%s %v was changed by someone else (expected version %d)", e.Entity, e.ID, e.Version)
+}
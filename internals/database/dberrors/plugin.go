@@ -0,0 +1,45 @@
+package dberrors
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Plugin translates the error of every statement run through GORM, so
+// repositories get typed errors without calling Translate themselves:
+//
+//	db.Use(dberrors.Plugin{})
+type Plugin struct{}
+
+func (Plugin) Name() string { return "dberrors" }
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().After("*").Register("dberrors:translate", translate),
+		cb.Query().After("*").Register("dberrors:translate", translate),
+		cb.Update().After("*").Register("dberrors:translate", translate),
+		cb.Delete().After("*").Register("dberrors:translate", translate),
+		cb.Row().After("*").Register("dberrors:translate", translate),
+		cb.Raw().After("*").Register("dberrors:translate", translate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func translate(db *gorm.DB) {
+	if db.Error == nil {
+		return
+	}
+	err := Translate(db.Error)
+	// name the entity, First(&user) -> "User not found"
+	var nf *ErrNotFound
+	if errors.As(err, &nf) && nf.Entity == "" && db.Statement.Schema != nil {
+		nf.Entity = db.Statement.Schema.Name
+	}
+	db.Error = err
+}
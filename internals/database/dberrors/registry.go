@@ -0,0 +1,56 @@
+package dberrors
+
+import (
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// fields maps index/constraint names to the columns they cover, the
+// databases only report the name.
+var fields sync.Map
+
+// Register records the unique indexes, unique constraints and check
+// constraints GORM derives for models, so errors on them can name the
+// columns involved. Call it once at startup with the migrated models.
+func Register(db *gorm.DB, models ...any) error {
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		sch := stmt.Schema
+
+		for _, idx := range sch.ParseIndexes() {
+			columns := make([]string, 0, len(idx.Fields))
+			for _, f := range idx.Fields {
+				if f.Field != nil {
+					columns = append(columns, f.DBName)
+				}
+			}
+			fields.Store(idx.Name, strings.Join(columns, ","))
+		}
+		for name, uni := range sch.ParseUniqueConstraints() {
+			fields.Store(name, uni.Field.DBName)
+		}
+		for name, chk := range sch.ParseCheckConstraints() {
+			fields.Store(name, chk.Field.DBName)
+		}
+		// a plain `unique` column shows up under the column name on
+		// databases that don't name the constraint
+		for _, f := range sch.Fields {
+			if f.Unique {
+				fields.LoadOrStore(f.DBName, f.DBName)
+			}
+		}
+	}
+	return nil
+}
+
+func fieldOf(constraint string) string {
+	if v, ok := fields.Load(constraint); ok {
+		return v.(string)
+	}
+	return ""
+}
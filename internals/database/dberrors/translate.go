@@ -0,0 +1,146 @@
+package dberrors
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	// Duplicate entry 'a@b.c' for key 'users.uni_users_email'
+	// (MySQL < 8.0.19 leaves the table name out)
+	mysqlDuplicate = regexp.MustCompile(`Duplicate entry '(.*)' for key '([^']+)'`)
+	// ... CONSTRAINT `fk_books_owner` FOREIGN KEY (`owner_id`) REFERENCES `users` (`id`)
+	mysqlForeignKey = regexp.MustCompile("CONSTRAINT `([^`]+)` FOREIGN KEY \\(([^)]+)\\) REFERENCES `([^`]+)`")
+	// Check constraint 'chk_book_reviews_rating' is violated.
+	mysqlCheck = regexp.MustCompile(`Check constraint '([^']+)' is violated`)
+	// MariaDB: CONSTRAINT `chk_book_reviews_rating` failed for `db`.`book_reviews`
+	mariadbCheck = regexp.MustCompile("CONSTRAINT `([^`]+)` failed")
+
+	// Key (email)=(a@b.c) already exists.
+	// Key (owner_id)=(42) is not present in table "users".
+	pgDetail = regexp.MustCompile(`Key \((.+?)\)=\((.*)\)`)
+	pgTable  = regexp.MustCompile(`table "([^"]+)"`)
+)
+
+// Translate turns a driver error into ErrDuplicate, ErrForeignKey, ErrCheck
+// or ErrNotFound. Any other error, and nil, is returned unchanged, as is an
+// error that was already translated.
+func Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == gorm.ErrRecordNotFound {
+		return &ErrNotFound{}
+	}
+	if alreadyTranslated(err) {
+		return err
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return fromMySQL(myErr, err)
+	}
+
+	// pgx and lib/pq errors both expose the SQLSTATE this way
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return fromPostgres(pgErr.SQLState(), pgErr, err)
+	}
+	return err
+}
+
+func alreadyTranslated(err error) bool {
+	var (
+		dup *ErrDuplicate
+		fk  *ErrForeignKey
+		chk *ErrCheck
+		nf  *ErrNotFound
+	)
+	return errors.As(err, &dup) || errors.As(err, &fk) || errors.As(err, &chk) || errors.As(err, &nf)
+}
+
+func fromMySQL(myErr *mysql.MySQLError, err error) error {
+	switch myErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		m := mysqlDuplicate.FindStringSubmatch(myErr.Message)
+		if m == nil {
+			return &ErrDuplicate{Err: err}
+		}
+		name := m[2]
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		return &ErrDuplicate{Constraint: name, Field: fieldOf(name), Value: m[1], Err: err}
+
+	case 1451, 1452, 1216, 1217: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2 and their old forms
+		m := mysqlForeignKey.FindStringSubmatch(myErr.Message)
+		if m == nil {
+			return &ErrForeignKey{Err: err}
+		}
+		field := strings.ReplaceAll(m[2], "`", "")
+		field = strings.ReplaceAll(field, " ", "")
+		return &ErrForeignKey{Constraint: m[1], Field: field, Table: m[3], Err: err}
+
+	case 3819, 4025: // ER_CHECK_CONSTRAINT_VIOLATED, MariaDB ER_CONSTRAINT_FAILED
+		var name string
+		if m := mysqlCheck.FindStringSubmatch(myErr.Message); m != nil {
+			name = m[1]
+		} else if m := mariadbCheck.FindStringSubmatch(myErr.Message); m != nil {
+			name = m[1]
+		}
+		return &ErrCheck{Constraint: name, Field: fieldOf(name), Err: err}
+	}
+	return err
+}
+
+func fromPostgres(state string, pgErr any, err error) error {
+	constraint := stringField(pgErr, "ConstraintName", "Constraint")
+	detail := stringField(pgErr, "Detail")
+
+	var field, value string
+	if m := pgDetail.FindStringSubmatch(detail); m != nil {
+		field, value = strings.ReplaceAll(m[1], " ", ""), m[2]
+	}
+	if field == "" {
+		field = stringField(pgErr, "ColumnName", "Column")
+	}
+	if field == "" {
+		field = fieldOf(constraint)
+	}
+
+	switch state {
+	case "23505": // unique_violation
+		return &ErrDuplicate{Constraint: constraint, Field: field, Value: value, Err: err}
+	case "23503": // foreign_key_violation
+		var table string
+		if m := pgTable.FindStringSubmatch(detail); m != nil {
+			table = m[1]
+		}
+		return &ErrForeignKey{Constraint: constraint, Field: field, Table: table, Err: err}
+	case "23514": // check_violation
+		return &ErrCheck{Constraint: constraint, Field: fieldOf(constraint), Err: err}
+	}
+	return err
+}
+
+// stringField reads the first of names that is a string field of the struct
+// behind v. pgx (*pgconn.PgError) and lib/pq (*pq.Error) name them
+// differently and neither is a dependency of this module.
+func stringField(v any, names ...string) string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range names {
+		f := rv.FieldByName(name)
+		if f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+// Package filter compiles query strings like
+//
+//	condition=like_new&author_id=2&location_city[like]=san&available_from[gte]=2025-10-01&sort=-created_at
+//
+// into GORM scopes. Every model declares which fields can be filtered, with
+// which operators, and which fields can be sorted on; anything else is
+// rejected. Column names only ever come from that whitelist and values are
+// always bound as parameters, so a query string can't inject SQL.
+package filter
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Op string
+
+const (
+	OpEq     Op = "eq"
+	OpIn     Op = "in"
+	OpGte    Op = "gte"
+	OpLte    Op = "lte"
+	OpLike   Op = "like"
+	OpIsNull Op = "is_null"
+)
+
+func (o Op) IsValid() bool {
+	switch o {
+	case OpEq, OpIn, OpGte, OpLte, OpLike, OpIsNull:
+		return true
+	}
+	return false
+}
+
+// Reserved query parameters are owned by other parts of a list request
+// (sorting, pagination, sparse fieldsets) and are skipped by the filter.
+var Reserved = []string{"sort", "limit", "after", "before", "fields"}
+
+// Field describes one filterable field.
+type Field struct {
+	// Column is the database column, optionally table qualified.
+	Column string
+	// Ops lists the accepted operators; the first one is used when the
+	// parameter has no `[op]` suffix.
+	Ops []Op
+	// Parse validates and converts values, it is not used for is_null.
+	Parse Parser
+}
+
+// Spec is the whitelist a model declares for list queries.
+type Spec struct {
+	// Fields maps a query parameter name to the field it filters.
+	Fields map[string]Field
+	// Sort maps a sort name to the column it orders by.
+	Sort map[string]string
+}
+
+// Error reports a rejected query parameter.
+type Error struct {
+	Param  string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("filter: invalid parameter %q: %s", e.Param, e.Reason)
+}
+
+// Where compiles the filter parameters of q into a scope. Unknown parameters,
+// operators a field doesn't allow and values that don't parse are errors.
+func (s Spec) Where(q url.Values) (func(*gorm.DB) *gorm.DB, error) {
+	var exprs []clause.Expression
+	// sorted, so the same query string always compiles to the same SQL
+	for _, param := range slices.Sorted(maps.Keys(q)) {
+		values := q[param]
+		name, op, err := splitParam(param)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(Reserved, name) {
+			continue
+		}
+
+		field, ok := s.Fields[name]
+		if !ok {
+			return nil, &Error{Param: param, Reason: "unknown filter"}
+		}
+		if op == "" && len(field.Ops) > 0 {
+			op = field.Ops[0]
+		}
+		if !slices.Contains(field.Ops, op) {
+			return nil, &Error{Param: param, Reason: fmt.Sprintf("operator %q is not allowed", op)}
+		}
+
+		for _, raw := range values {
+			expr, err := field.expression(op, raw)
+			if err != nil {
+				return nil, &Error{Param: param, Reason: err.Error()}
+			}
+			exprs = append(exprs, expr)
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if len(exprs) == 0 {
+			return db
+		}
+		return db.Clauses(clause.Where{Exprs: exprs})
+	}, nil
+}
+
+// SortKeys resolves the `sort` parameter (e.g. "-created_at,title") into
+// pagination keys, falling back to def when it is absent.
+func (s Spec) SortKeys(q url.Values, def ...pagination.Key) ([]pagination.Key, error) {
+	spec := q.Get("sort")
+	if spec == "" {
+		return def, nil
+	}
+
+	var keys []pagination.Key
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		column, ok := s.Sort[strings.TrimPrefix(part, "-")]
+		if !ok {
+			return nil, &Error{Param: "sort", Reason: fmt.Sprintf("can't sort by %q", strings.TrimPrefix(part, "-"))}
+		}
+		keys = append(keys, pagination.Key{Column: column, Desc: strings.HasPrefix(part, "-")})
+	}
+	return keys, nil
+}
+
+// Scope compiles both the filters and the sort of q, for plain (not cursor
+// paginated) list queries.
+func (s Spec) Scope(q url.Values) (func(*gorm.DB) *gorm.DB, error) {
+	where, err := s.Where(q)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.SortKeys(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		db = where(db)
+		for _, k := range keys {
+			db = db.Order(clause.OrderByColumn{Column: column(k.Column), Desc: k.Desc})
+		}
+		return db
+	}, nil
+}
+
+func (f Field) expression(op Op, raw string) (clause.Expression, error) {
+	col := column(f.Column)
+
+	if op == OpIsNull {
+		null, err := Bool(raw)
+		if err != nil {
+			return nil, err
+		}
+		if null.(bool) {
+			return clause.Eq{Column: col, Value: nil}, nil
+		}
+		return clause.Neq{Column: col, Value: nil}, nil
+	}
+
+	if op == OpIn {
+		parts := strings.Split(raw, ",")
+		values := make([]any, len(parts))
+		for i, p := range parts {
+			v, err := f.Parse(strings.TrimSpace(p))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return clause.IN{Column: col, Values: values}, nil
+	}
+
+	v, err := f.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case OpGte:
+		return clause.Gte{Column: col, Value: v}, nil
+	case OpLte:
+		return clause.Lte{Column: col, Value: v}, nil
+	case OpLike:
+		return clause.Like{Column: col, Value: "%" + escapeLike(fmt.Sprint(v)) + "%"}, nil
+	}
+	return clause.Eq{Column: col, Value: v}, nil
+}
+
+// splitParam splits `available_from[gte]` into its name and operator.
+func splitParam(param string) (string, Op, error) {
+	name, rest, ok := strings.Cut(param, "[")
+	if !ok {
+		return param, "", nil
+	}
+	op := Op(strings.TrimSuffix(rest, "]"))
+	if !strings.HasSuffix(rest, "]") || !op.IsValid() {
+		return "", "", &Error{Param: param, Reason: "unknown operator"}
+	}
+	return name, op, nil
+}
+
+func column(name string) clause.Column {
+	if table, col, ok := strings.Cut(name, "."); ok {
+		return clause.Column{Table: table, Name: col}
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: name}
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
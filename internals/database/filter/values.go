@@ -0,0 +1,53 @@
+package filter
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Parser converts a raw query string value into the value bound to the SQL
+// statement. Returning an error rejects the whole filter.
+type Parser func(string) (any, error)
+
+// String accepts any value as is.
+func String(s string) (any, error) {
+	return s, nil
+}
+
+// Uint accepts unsigned integers, typically ids.
+func Uint(s string) (any, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// Int accepts signed integers.
+func Int(s string) (any, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Bool accepts the values understood by strconv.ParseBool.
+func Bool(s string) (any, error) {
+	return strconv.ParseBool(s)
+}
+
+// Time accepts an RFC 3339 timestamp or a plain `2006-01-02` date.
+func Time(s string) (any, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// Enum accepts only values the enum type itself considers valid, e.g.
+// Enum[models.Condition]() rejects `condition=mint`.
+func Enum[E interface {
+	~string
+	IsValid() bool
+}]() Parser {
+	return func(s string) (any, error) {
+		if !E(s).IsValid() {
+			return nil, errors.New("not an accepted value")
+		}
+		return E(s), nil
+	}
+}
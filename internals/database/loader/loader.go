@@ -0,0 +1,204 @@
+// Package loader batches and caches lookups by id for the length of a
+// request, dataloader style.
+//
+// Code resolving the requester, responder and shipping payer of a page of
+// exchanges asks for each user on its own; the loader collects the ids asked
+// for within a short tick, fetches them with one `WHERE id IN ?` query and
+// hands every caller its own row. Rows stay cached until the loader is
+// dropped with its request, a user asked for twice is only read once:
+//
+//	loaders := loader.New(db.WithContext(r.Context()))
+//	requester, err := loaders.Users.Load(ctx, ex.RequesterID)
+//	if errors.As(err, new(*dberrors.ErrNotFound)) {
+//		// no such user
+//	}
+//
+// A loader is not meant to outlive its request: it never sees the writes
+// made after a row was loaded.
+package loader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWait is how long a batch collects keys before it is fetched.
+	DefaultWait = time.Millisecond
+	// DefaultMaxBatch is the number of keys fetched with one query at most.
+	DefaultMaxBatch = 500
+)
+
+// Fetch returns the values of keys; a key missing from the map is not found.
+type Fetch[K comparable, V any] func(keys []K) (map[K]V, error)
+
+// Loader batches and caches the lookups of V by K.
+type Loader[K comparable, V any] struct {
+	// Wait and MaxBatch are read when a batch starts, set them before the
+	// first Load.
+	Wait     time.Duration
+	MaxBatch int
+
+	fetch    Fetch[K, V]
+	notFound func(K) error
+
+	mu      sync.Mutex
+	results map[K]*result[V]
+	pending *batch[K, V]
+}
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	results []*result[V]
+	timer   *time.Timer
+}
+
+// NewLoader returns a Loader getting its values from fetch; notFound makes
+// the error of a key fetch didn't return.
+func NewLoader[K comparable, V any](fetch Fetch[K, V], notFound func(K) error) *Loader[K, V] {
+	return &Loader[K, V]{
+		Wait:     DefaultWait,
+		MaxBatch: DefaultMaxBatch,
+		fetch:    fetch,
+		notFound: notFound,
+		results:  map[K]*result[V]{},
+	}
+}
+
+// Load returns the value of key, fetched with the other keys asked for in
+// the meantime unless it is cached.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	return l.wait(ctx, l.enqueue(key))
+}
+
+// LoadMany returns the values of keys in the same order, in one batch. errs
+// is nil when all of them were loaded, otherwise errs[i] is the error of
+// keys[i].
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (values []V, errs []error) {
+	pending := make([]*result[V], len(keys))
+	for i, key := range keys {
+		pending[i] = l.enqueue(key)
+	}
+
+	values = make([]V, len(keys))
+	for i, r := range pending {
+		var err error
+		values[i], err = l.wait(ctx, r)
+		if err != nil {
+			if errs == nil {
+				errs = make([]error, len(keys))
+			}
+			errs[i] = err
+		}
+	}
+	return values, errs
+}
+
+// Prime caches value for key, e.g. a row the request has just created.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	r := &result[V]{done: make(chan struct{}), value: value}
+	close(r.done)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results[key] = r
+}
+
+// Clear drops the cached value of key, the next Load fetches it again.
+func (l *Loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.results, key)
+}
+
+// enqueue returns the (possibly pending) result of key, adding key to the
+// current batch if it isn't cached.
+func (l *Loader[K, V]) enqueue(key K) *result[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r, ok := l.results[key]; ok {
+		return r
+	}
+	r := &result[V]{done: make(chan struct{})}
+	l.results[key] = r
+
+	if l.pending == nil {
+		b := &batch[K, V]{}
+		b.timer = time.AfterFunc(l.Wait, func() { l.dispatch(b) })
+		l.pending = b
+	}
+	b := l.pending
+	b.keys = append(b.keys, key)
+	b.results = append(b.results, r)
+
+	if len(b.keys) >= l.MaxBatch {
+		b.timer.Stop()
+		l.pending = nil
+		go l.run(b)
+	}
+	return r
+}
+
+// dispatch runs b when its tick is over, unless it filled up before.
+func (l *Loader[K, V]) dispatch(b *batch[K, V]) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.run(b)
+}
+
+func (l *Loader[K, V]) run(b *batch[K, V]) {
+	values, err := l.safeFetch(b.keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, key := range b.keys {
+		r := b.results[i]
+		if err != nil {
+			r.err = err
+			// not cached, the next Load tries again
+			if l.results[key] == r {
+				delete(l.results, key)
+			}
+		} else if v, ok := values[key]; ok {
+			r.value = v
+		} else {
+			r.err = l.notFound(key)
+		}
+		close(r.done)
+	}
+}
+
+// safeFetch keeps a panicking fetch from leaving the callers waiting forever.
+func (l *Loader[K, V]) safeFetch(keys []K) (values map[K]V, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("loader: fetch panicked: %v", p)
+		}
+	}()
+	return l.fetch(keys)
+}
+
+func (l *Loader[K, V]) wait(ctx context.Context, r *result[V]) (V, error) {
+	select {
+	case <-r.done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
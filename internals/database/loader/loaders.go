@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"context"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+)
+
+// Loaders are the loaders of one request.
+type Loaders struct {
+	// Users come with their UserProfile.
+	Users *Loader[uint, *models.User]
+	Books *Loader[uint, *models.Book]
+}
+
+// New returns the loaders of a request reading from db, which should be bound
+// to the request's context so that the batches stop with it.
+func New(db *gorm.DB) *Loaders {
+	return &Loaders{
+		Users: NewLoader(byID(db, func(u *models.User) uint { return u.ID }, func(tx *gorm.DB) *gorm.DB {
+			return tx.Preload("UserProfile")
+		}), notFound("User")),
+		Books: NewLoader(byID(db, func(b *models.Book) uint { return b.ID }, nil), notFound("Book")),
+	}
+}
+
+// byID fetches T rows by id, with scope applied to the query.
+func byID[T any](db *gorm.DB, id func(*T) uint, scope func(*gorm.DB) *gorm.DB) Fetch[uint, *T] {
+	return func(ids []uint) (map[uint]*T, error) {
+		q := db.Where("id IN ?", ids)
+		if scope != nil {
+			q = scope(q)
+		}
+		var rows []T
+		if err := q.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		found := make(map[uint]*T, len(rows))
+		for i := range rows {
+			found[id(&rows[i])] = &rows[i]
+		}
+		return found, nil
+	}
+}
+
+func notFound(entity string) func(uint) error {
+	return func(uint) error { return &dberrors.ErrNotFound{Entity: entity} }
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying loaders.
+func NewContext(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, ctxKey{}, loaders)
+}
+
+// FromContext returns the loaders carried by ctx.
+func FromContext(ctx context.Context) (*Loaders, bool) {
+	loaders, ok := ctx.Value(ctxKey{}).(*Loaders)
+	return loaders, ok
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/archive"
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Models returns the models AutoMigrate creates the tables of.
+func Models() []any {
+	return []any{
+		&models.ActivityLog{},
+		&models.Author{},
+		&models.BookImage{},
+		&models.BookReview{},
+		&models.Book{},
+		&models.ChatThread{},
+		&models.CommunityMember{},
+		&models.CommunityMessage{},
+		&models.CommunityThread{},
+		&models.Community{},
+		&models.Exchange{},
+		&models.Genre{},
+		// locations starts
+		&models.Country{},
+		&models.State{},
+		&models.City{},
+		// locations ends
+		&models.MessageQuotaUsage{},
+		&models.Message{},
+		&models.ModerationAction{},
+		&models.Notification{},
+		&models.Report{},
+		&models.SubscriptionPlan{},
+		&models.Subscription{},
+		&models.UserProfile{},
+		&models.UserRating{},
+		&models.User{},
+		&models.Payment{},
+	}
+}
+
+// SchemaMigration is a schema version Migrate has applied.
+type SchemaMigration struct {
+	Version   string    `json:"version" gorm:"primaryKey;size:64"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null;index"`
+}
+
+// Migrate migrates the tables of Models and the archive tables, then records
+// the schema version. Instances of another build don't consider the
+// database ready until it has been migrated to their version, see
+// SchemaVersion.
+func Migrate(db *gorm.DB) error {
+	tables := Models()
+	if err := db.AutoMigrate(tables...); err != nil {
+		return fmt.Errorf("migrating tables: %w", err)
+	}
+	if err := dropSuperseded(db); err != nil {
+		return err
+	}
+	// let constraint violations name the columns involved
+	if err := dberrors.Register(db, tables...); err != nil {
+		return fmt.Errorf("registering constraints: %w", err)
+	}
+	if err := archive.Migrate(db); err != nil {
+		return fmt.Errorf("migrating archive tables: %w", err)
+	}
+
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("migrating schema_migrations: %w", err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	// re-applying a version only moves its applied_at
+	err = db.Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"applied_at"})}).
+		Create(&SchemaMigration{Version: version, AppliedAt: time.Now()}).Error
+	if err != nil {
+		return fmt.Errorf("recording schema version: %w", err)
+	}
+	return nil
+}
+
+// superseded are indexes a wider one replaced, AutoMigrate only ever adds
+// indexes.
+var superseded = []struct {
+	model any
+	name  string
+}{
+	// led by user_id, idx_notifications_inbox serves its lookups
+	{&models.Notification{}, "idx_notifications_user_id"},
+}
+
+// supersededForeignKeys are foreign keys the models no longer declare,
+// AutoMigrate never drops one either.
+var supersededForeignKeys = []struct {
+	model any
+	name  string
+}{
+	// user_ratings.exchange_id outlives its exchange's move to the archive
+	{&models.UserRating{}, "fk_exchanges_user_ratings"},
+}
+
+func dropSuperseded(db *gorm.DB) error {
+	for _, idx := range superseded {
+		if !db.Migrator().HasIndex(idx.model, idx.name) {
+			continue
+		}
+		if err := db.Migrator().DropIndex(idx.model, idx.name); err != nil {
+			return fmt.Errorf("dropping index %s: %w", idx.name, err)
+		}
+	}
+	for _, fk := range supersededForeignKeys {
+		if !db.Migrator().HasConstraint(fk.model, fk.name) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(fk.model); err != nil {
+			return err
+		}
+		// DropConstraint says DROP CONSTRAINT, which older MariaDB doesn't
+		// take for foreign keys
+		if err := db.Exec("ALTER TABLE ? DROP FOREIGN KEY ?", clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: fk.name}).Error; err != nil {
+			return fmt.Errorf("dropping foreign key %s: %w", fk.name, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the schema version of this build: a digest of the
+// tables of Models with their column definitions, so it changes whenever a
+// model gains, loses or changes a column.
+func SchemaVersion(db *gorm.DB) (string, error) {
+	sum := sha256.New()
+	for _, model := range Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return "", fmt.Errorf("parsing %T: %w", model, err)
+		}
+		columns := make([]string, 0, len(stmt.Schema.DBNames))
+		for _, name := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[name]
+			columns = append(columns, name+" "+db.Migrator().FullDataTypeOf(field).SQL)
+		}
+		slices.Sort(columns)
+		fmt.Fprintf(sum, "%s(%s)\n", stmt.Schema.Table, strings.Join(columns, ", "))
+	}
+	return hex.EncodeToString(sum.Sum(nil))[:16], nil
+}
+
+// AppliedMigration returns the schema version Migrate applied last, nil when
+// the database has never been migrated.
+func AppliedMigration(ctx context.Context, db *gorm.DB) (*SchemaMigration, error) {
+	db = db.WithContext(ctx)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil, nil
+	}
+	var m SchemaMigration
+	err := db.Order("applied_at DESC").Limit(1).Find(&m).Error
+	if err != nil || m.Version == "" {
+		return nil, err
+	}
+	return &m, nil
+}
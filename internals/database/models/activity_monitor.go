@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
 	"gorm.io/gorm"
 )
 
@@ -38,10 +39,26 @@ type ActivityLog struct {
 	RequestID string `json:"request_id,omitempty" gorm:"size:100"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
+
+// FilterSpec whitelists the fields activity log lists can be filtered and sorted by.
+func (ActivityLog) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"user_id":     {Column: "user_id", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpIsNull}, Parse: filter.Uint},
+			"action":      {Column: "action", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[ActivityAction]()},
+			"object_type": {Column: "object_type", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.String},
+			"object_id":   {Column: "object_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"created_at":  {Column: "created_at", Ops: []filter.Op{filter.OpGte, filter.OpLte}, Parse: filter.Time},
+		},
+		Sort: map[string]string{
+			"created_at": "created_at",
+		},
+	}
+}
@@ -12,7 +12,7 @@ type Author struct {
 	Name string `json:"name,omitempty" gorm:"uniqueIndex"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
 	"gorm.io/gorm"
 )
 
@@ -47,11 +49,27 @@ type Book struct {
 	ArchivedAt      *time.Time `json:"archived_at,omitempty"`
 	PreferredTitles *string    `json:"preferred_titles,omitempty" gorm:"type:json"`
 
+	// counters of the live reviews, kept by the counter plugin
+	ReviewsCount uint `json:"reviews_count" gorm:"<-:false;not null;default:0"`
+	RatingSum    uint `json:"rating_sum" gorm:"<-:false;not null;default:0"`
+	// computed by the database from the counters, so they follow every
+	// review written: the average rating, and the Bayesian average books
+	// are ranked by, pulling a book with few reviews towards a prior of 3.5
+	// stars worth 10 reviews (a single 5 star review doesn't outrank a
+	// hundred 4.8s). The prior is only written down in the column
+	// definition, (10 * 3.5 + rating_sum) / (10 + reviews_count); changing
+	// it is a migration of the column.
+	RatingAvg   *float64 `json:"rating_avg,omitempty" gorm:"->;type:decimal(4,3) GENERATED ALWAYS AS (CASE WHEN reviews_count > 0 THEN rating_sum / reviews_count END) STORED"`
+	RatingScore float64  `json:"rating_score" gorm:"->;type:decimal(4,3) GENERATED ALWAYS AS ((35 + rating_sum) / (10 + reviews_count)) STORED;index"`
+
+	// bumped on every update, see optlock
+	Version optlock.Version `json:"version" gorm:"not null;default:1"`
+
 	// timestamps
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
-	// using `gorm.DeletedAt` makes it possible to soft delete a user
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	// soft delete, see the softdelete package
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Owner       *User         `json:"owner,omitempty" gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
@@ -61,70 +79,30 @@ type Book struct {
 	BookReviews []*BookReview `json:"book_reviews,omitempty" gorm:"foreignKey:BookID"`
 }
 
-//
-//
-// I'm going to store the books_count in the User table.
-//
-//
-
-// // AfterCreate: increment owner's counter
-// func (b *Book) AfterCreate(tx *gorm.DB) (err error) {
-// 	if b.OwnerID == 0 {
-// 		return nil
-// 	}
-// 	return tx.Model(&User{}).
-// 		Where("id = ?", b.OwnerID).
-// 		UpdateColumn("books_count", gorm.Expr("books_count + ?", 1)).Error
-// }
-
-// // AfterDelete: decrement owner's counter
-// func (b *Book) AfterDelete(tx *gorm.DB) (err error) {
-// 	if b.OwnerID == 0 {
-// 		return nil
-// 	}
-// 	return tx.Model(&User{}).
-// 		Where("id = ?", b.OwnerID).
-// 		UpdateColumn("books_count", gorm.Expr("GREATEST(books_count - ?, 0)", 1)).Error
-// }
-
-// // BeforeUpdate: record previous owner id into the statement context
-// func (b *Book) BeforeUpdate(tx *gorm.DB) (err error) {
-// 	var old Book
-// 	if err := tx.Unscoped().Select("owner_id").Where("id = ?", b.ID).Take(&old).Error; err == nil {
-// 		tx.InstanceSet("old_owner_id", old.OwnerID)
-// 	}
-// 	return nil
-// }
-
-// // AfterUpdate: if owner changed, update both old and new owner's counters
-// func (b *Book) AfterUpdate(tx *gorm.DB) (err error) {
-// 	v, ok := tx.InstanceGet("old_owner_id")
-// 	if !ok {
-// 		return nil
-// 	}
-// 	oldOwnerID, _ := v.(uint)
-// 	newOwnerID := b.OwnerID
-
-// 	// If owner didn't change, nothing to do.
-// 	if oldOwnerID == newOwnerID {
-// 		return nil
-// 	}
-
-// 	// Decrement old owner
-// 	if oldOwnerID != 0 {
-// 		if err := tx.Model(&User{}).
-// 			Where("id = ?", oldOwnerID).
-// 			UpdateColumn("books_count", gorm.Expr("GREATEST(books_count - ?, 0)", 1)).Error; err != nil {
-// 			return err
-// 		}
-// 	}
-// 	// Increment new owner
-// 	if newOwnerID != 0 {
-// 		if err := tx.Model(&User{}).
-// 			Where("id = ?", newOwnerID).
-// 			UpdateColumn("books_count", gorm.Expr("books_count + ?", 1)).Error; err != nil {
-// 			return err
-// 		}
-// 	}
-// 	return nil
-// }
+// FilterSpec whitelists the fields book lists can be filtered and sorted by.
+func (Book) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"owner_id":         {Column: "owner_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"author_id":        {Column: "author_id", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpIsNull}, Parse: filter.Uint},
+			"title":            {Column: "title", Ops: []filter.Op{filter.OpLike, filter.OpEq}, Parse: filter.String},
+			"condition":        {Column: "condition", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[Condition]()},
+			"language":         {Column: "language", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.String},
+			"location_city":    {Column: "location_city", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpLike, filter.OpIsNull}, Parse: filter.String},
+			"location_state":   {Column: "location_state", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpLike, filter.OpIsNull}, Parse: filter.String},
+			"location_country": {Column: "location_country", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpLike, filter.OpIsNull}, Parse: filter.String},
+			"available_from":   {Column: "available_from", Ops: []filter.Op{filter.OpGte, filter.OpLte, filter.OpIsNull}, Parse: filter.Time},
+			"available_until":  {Column: "available_until", Ops: []filter.Op{filter.OpGte, filter.OpLte, filter.OpIsNull}, Parse: filter.Time},
+			"active":           {Column: "active", Ops: []filter.Op{filter.OpEq}, Parse: filter.Bool},
+		},
+		Sort: map[string]string{
+			"title":           "title",
+			"created_at":      "created_at",
+			"available_from":  "available_from",
+			"available_until": "available_until",
+			"reviews_count":   "reviews_count",
+			"rating_avg":      "rating_avg",
+			"rating_score":    "rating_score",
+		},
+	}
+}
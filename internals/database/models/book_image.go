@@ -16,11 +16,11 @@ type BookImage struct {
 	UploadedAt time.Time `json:"uploaded_at"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationships
-	BookID uint `json:"book_id"`
-	Book   Book `json:"book"`
+	BookID uint  `json:"book_id"`
+	Book   *Book `json:"book,omitempty"`
 }
@@ -14,9 +14,9 @@ type ChatThread struct {
 	Archived   bool `json:"archived,omitempty" gorm:"default:false"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationships
 	Exchange *Exchange  `json:"exchange,omitempty" gorm:"foreignKey:ExchangeID"`
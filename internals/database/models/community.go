@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
 	"gorm.io/gorm"
 )
 
@@ -15,13 +16,34 @@ type Community struct {
 	CreatorID       uint   `json:"creator_id,omitempty" gorm:"index"`
 	RequirePaidChat bool   `json:"require_paid_chat,omitempty" gorm:"default:true"`
 
+	// counters of the live members and messages, kept by the counter plugin
+	MembersCount  uint `json:"members_count" gorm:"<-:false;not null;default:0"`
+	MessagesCount uint `json:"messages_count" gorm:"<-:false;not null;default:0"`
+
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Creator User              `json:"creator,omitempty" gorm:"foreignKey:CreatorID"`
 	Members []CommunityMember `json:"members,omitempty" gorm:"foreignKey:CommunityID"`
-	Threads []CommunityThread `json:"threads,omitempty" gorm:"foreignKey:CommunityID"`
+	Threads []CommunityThread `json:"threads,omitempty" gorm:"foreignKey:CommunityID;constraint:OnDelete:CASCADE"`
+}
+
+// FilterSpec whitelists the fields community lists can be filtered and sorted by.
+func (Community) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"name":              {Column: "name", Ops: []filter.Op{filter.OpLike, filter.OpEq}, Parse: filter.String},
+			"slug":              {Column: "slug", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpLike}, Parse: filter.String},
+			"creator_id":        {Column: "creator_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"require_paid_chat": {Column: "require_paid_chat", Ops: []filter.Op{filter.OpEq}, Parse: filter.Bool},
+		},
+		Sort: map[string]string{
+			"name":          "name",
+			"created_at":    "created_at",
+			"members_count": "members_count",
+		},
+	}
 }
@@ -32,9 +32,9 @@ type CommunityMember struct {
 	JoinedAt      time.Time     `json:"joined_at" gorm:"autoCreateTime"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Community *Community `json:"community,omitempty" gorm:"foreignKey:CommunityID"`
@@ -14,9 +14,9 @@ type CommunityMessage struct {
 	Body     string `json:"body,omitempty" gorm:"type:text;not null"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Thread *CommunityThread `json:"thread,omitempty" gorm:"foreignKey:ThreadID"`
@@ -13,14 +13,22 @@ type CommunityThread struct {
 	CreatedBy   uint   `json:"created_by,omitempty" gorm:"index"`
 	Title       string `json:"title,omitempty" gorm:"size:500"`
 
+	// pinned threads are listed first, pinning is for community admins and
+	// moderators
+	Pinned   bool       `json:"pinned" gorm:"not null;default:false"`
+	PinnedAt *time.Time `json:"pinned_at,omitempty"`
+
+	// kept by the counter plugin
+	MessagesCount uint `json:"messages_count" gorm:"<-:false;not null;default:0"`
+
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationship
 	Community *Community         `json:"community,omitempty" gorm:"foreignKey:CommunityID"`
 	Creator   *User              `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
-	Messages  []CommunityMessage `json:"messages,omitempty" gorm:"foreignKey:ThreadID"`
+	Messages  []CommunityMessage `json:"messages,omitempty" gorm:"foreignKey:ThreadID;constraint:OnDelete:CASCADE"`
 	// Messages  []CommunityMessage `json:"messages,omitempty" gorm:"foreignKey:ThreadID"`
 }
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
 	"gorm.io/gorm"
 )
 
@@ -53,10 +55,13 @@ type Exchange struct {
 	Archived               bool       `json:"archived,omitempty" gorm:"default:false"`
 	Metadata               *string    `json:"metadata,omitempty" gorm:"type:json"`
 
+	// bumped on every update, see optlock
+	Version optlock.Version `json:"version" gorm:"not null;default:1"`
+
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Requester     *User         `json:"requester,omitempty" gorm:"foreignKey:RequesterID;constraint:OnDelete:CASCADE"`
@@ -65,5 +70,28 @@ type Exchange struct {
 	ResponderBook *Book         `json:"responder_book,omitempty" gorm:"foreignKey:ResponderBookID;constraint:OnDelete:SET NULL"`
 	ShippingPayer *User         `json:"shipping_payer,omitempty" gorm:"foreignKey:ShippingPayerUserID;constraint:OnDelete:SET NULL"`
 	ChatThreads   []*ChatThread `json:"chat_threads,omitempty" gorm:"foreignKey:ExchangeID;constraint:OnDelete:CASCADE"`
-	UserRatings   []*UserRating `json:"user_ratings,omitempty" gorm:"foreignKey:ExchangeID;constraint:OnDelete:SET NULL"`
+	// no foreign key: exchanges move to the archive tables, the ratings of
+	// an archived exchange keep pointing at it (see archive.Run)
+	UserRatings []*UserRating `json:"user_ratings,omitempty" gorm:"foreignKey:ExchangeID;constraint:-"`
+}
+
+// FilterSpec whitelists the fields exchange lists can be filtered and sorted by.
+func (Exchange) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"status":            {Column: "status", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[Status]()},
+			"requester_id":      {Column: "requester_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"responder_id":      {Column: "responder_id", Ops: []filter.Op{filter.OpEq, filter.OpIn, filter.OpIsNull}, Parse: filter.Uint},
+			"requester_book_id": {Column: "requester_book_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"responder_book_id": {Column: "responder_book_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"archived":          {Column: "archived", Ops: []filter.Op{filter.OpEq}, Parse: filter.Bool},
+			"requested_at":      {Column: "requested_at", Ops: []filter.Op{filter.OpGte, filter.OpLte}, Parse: filter.Time},
+			"completed_at":      {Column: "completed_at", Ops: []filter.Op{filter.OpGte, filter.OpLte, filter.OpIsNull}, Parse: filter.Time},
+		},
+		Sort: map[string]string{
+			"requested_at":      "requested_at",
+			"status_updated_at": "status_updated_at",
+			"created_at":        "created_at",
+		},
+	}
 }
@@ -8,11 +8,11 @@ import (
 
 type Genre struct {
 	// gorm.Model
-	ID        uint            `json:"id" gorm:"primaryKey"`
-	Slug      string          `json:"slug,omitempty"`
-	Name      string          `json:"name,omitempty"`
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
-	Books     []Book          `json:"books,omitempty" gorm:"many2many:book_genres;"`
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Slug      string         `json:"slug,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	Books     []Book         `json:"books,omitempty" gorm:"many2many:book_genres;"`
 }
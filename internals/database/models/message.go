@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
 	"gorm.io/gorm"
 )
 
@@ -29,18 +30,38 @@ type Message struct {
 	// gorm.Model
 	ID          uint        `json:"id,omitempty" gorm:"primaryKey"`
 	ThreadID    uint        `json:"thread_id,omitempty" gorm:"index"`
-	SenderID    uint        `json:"sender_id,omitempty" gorm:"index"`
+	SenderID    uint        `json:"sender_id,omitempty" gorm:"index;uniqueIndex:idx_messages_client,priority:1"`
 	Type        MessageType `json:"type,omitempty" gorm:"type:enum('text','image','file','system')"`
 	Body        string      `json:"body,omitempty" gorm:"type:text"`
 	Attachments string      `json:"attachments,omitempty" gorm:"type:json"` // JSON array of attachment URLs
 	Deleted     bool        `json:"deleted,omitempty" gorm:"default:false"`
+	// ClientID is the sender's own id for the message, a message sent again
+	// with the same one (its ack got lost) is only stored once.
+	ClientID *string `json:"client_id,omitempty" gorm:"size:64;uniqueIndex:idx_messages_client,priority:2"`
+	// DeliveredAt is when the other participant's client acked the message.
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationships
 	Thread *ChatThread `json:"thread,omitempty" gorm:"foreignKey:ThreadID"`
 	Sender *User       `json:"sender,omitempty" gorm:"foreignKey:SenderID"`
 }
+
+// FilterSpec whitelists the fields message lists can be filtered and sorted by.
+func (Message) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"sender_id":  {Column: "sender_id", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Uint},
+			"type":       {Column: "type", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[MessageType]()},
+			"body":       {Column: "body", Ops: []filter.Op{filter.OpLike}, Parse: filter.String},
+			"created_at": {Column: "created_at", Ops: []filter.Op{filter.OpGte, filter.OpLte}, Parse: filter.Time},
+		},
+		Sort: map[string]string{
+			"created_at": "created_at",
+		},
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +17,8 @@ const (
 	NotificationTypeExchangeShipped          NotificationType = "exchange_shipped"
 	NotificationTypeExchangeDelivered        NotificationType = "exchange_delivered"
 	NotificationTypeExchangeCompleted        NotificationType = "exchange_completed"
+	NotificationTypeExchangeCanceled         NotificationType = "exchange_canceled"
+	NotificationTypeExchangeDisputed         NotificationType = "exchange_disputed"
 	NotificationTypeNewMessageInExchange     NotificationType = "new_message_in_exchange"
 	NotificationTypeNewCommunityMessage      NotificationType = "new_community_message"
 	NotificationTypeBookReviewReceived       NotificationType = "book_review_received"
@@ -30,6 +36,8 @@ func (nt NotificationType) IsValid() bool {
 		NotificationTypeExchangeShipped,
 		NotificationTypeExchangeDelivered,
 		NotificationTypeExchangeCompleted,
+		NotificationTypeExchangeCanceled,
+		NotificationTypeExchangeDisputed,
 		NotificationTypeNewMessageInExchange,
 		NotificationTypeNewCommunityMessage,
 		NotificationTypeBookReviewReceived,
@@ -42,15 +50,52 @@ func (nt NotificationType) IsValid() bool {
 }
 
 type Notification struct {
-	gorm.Model
-	UserID  uint             `json:"user_id" gorm:"index;not null"`
+	// gorm.Model, spelled out for the inbox index on created_at
+	ID uint `json:"id" gorm:"primaryKey"`
+	// idx_notifications_inbox serves the inbox (user_id, newest first) and
+	// narrows the unread count (user_id, read) down to the rows it counts
+	UserID  uint             `json:"user_id" gorm:"not null;index:idx_notifications_inbox,priority:1"`
 	Type    NotificationType `json:"type" gorm:"size:100;not null"`
 	Payload string           `json:"payload" gorm:"type:json"`
-	Read    bool             `json:"read" gorm:"default:false"`
+	Read    bool             `json:"read" gorm:"not null;default:false;index:idx_notifications_inbox,priority:2"`
 
 	// previous database design field -- reverse if needed
 	// Type    string `json:"type" gorm:"size:100;not null"`
 
+	// timestamps; idx_notifications_created_at serves the poll backend of
+	// the events package, which looks for notifications by created_at
+	CreatedAt *time.Time     `json:"created_at,omitempty" gorm:"index:idx_notifications_inbox,priority:3;index:idx_notifications_created_at"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
 	// Relationships
-	User *User `json:"user" gorm:"foreignKey:UserID"`
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// MarshalJSON writes Payload as the JSON it holds rather than as a string,
+// null when it is empty.
+func (n Notification) MarshalJSON() ([]byte, error) {
+	type plain Notification
+	var payload json.RawMessage
+	if n.Payload != "" {
+		payload = json.RawMessage(n.Payload)
+	}
+	return json.Marshal(struct {
+		plain
+		Payload json.RawMessage `json:"payload"`
+	}{plain(n), payload})
+}
+
+// FilterSpec whitelists the fields notification lists can be filtered and sorted by.
+func (Notification) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"type":       {Column: "type", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[NotificationType]()},
+			"read":       {Column: "read", Ops: []filter.Op{filter.OpEq}, Parse: filter.Bool},
+			"created_at": {Column: "created_at", Ops: []filter.Op{filter.OpGte, filter.OpLte}, Parse: filter.Time},
+		},
+		Sort: map[string]string{
+			"created_at": "created_at",
+		},
+	}
 }
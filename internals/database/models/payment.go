@@ -25,11 +25,11 @@ type Payment struct {
 	Status         PaymentStatus  `json:"status" gorm:"type:enum('pending','succeeded','failed','refunded','canceled');not null;default:'pending'"`
 	Metadata       datatypes.JSON `json:"metadata" gorm:"type:json"`
 
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationships
-	User         User         `json:"user" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	Subscription Subscription `json:"subscription" gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE"`
+	User         *User         `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Subscription *Subscription `json:"subscription,omitempty" gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE"`
 }
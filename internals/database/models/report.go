@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
 	"gorm.io/gorm"
 )
 
@@ -18,10 +19,13 @@ type Report struct {
 	HandledAt  time.Time `json:"handled_at,omitempty" gorm:"autoUpdateTime"`
 	Resolution string    `json:"resolution,omitempty" gorm:"type:text"`
 
+	// bumped on every update, see optlock
+	Version optlock.Version `json:"version" gorm:"not null;default:1"`
+
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Reporter User `json:"reporter,omitempty" gorm:"foreignKey:ReporterID"`
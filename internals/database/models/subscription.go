@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
 	"gorm.io/gorm"
 )
 
@@ -35,10 +36,13 @@ type Subscription struct {
 	CurrentPeriodEnd       *time.Time         `json:"current_period_end,omitempty" gorm:"type:datetime"`
 	CancelAtPeriodEnd      bool               `json:"cancel_at_period_end,omitempty" gorm:"type:tinyint(1);default:0"`
 
+	// bumped on every update, see optlock
+	Version optlock.Version `json:"version" gorm:"not null;default:1"`
+
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// relationship
 	User *User            `json:"user,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
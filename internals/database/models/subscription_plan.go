@@ -24,6 +24,17 @@ func (i Interval) IsValid() bool {
 	return false
 }
 
+// After returns the end of a billing period of this interval starting at t.
+func (i Interval) After(t time.Time) time.Time {
+	switch i {
+	case Interval3Month:
+		return t.AddDate(0, 3, 0)
+	case IntervalYear:
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
 /** enums ends */
 
 type SubscriptionPlan struct {
@@ -39,7 +50,7 @@ type SubscriptionPlan struct {
 	Active      bool           `json:"active,omitempty" gorm:"type:tinyint(1);not null;default:1"`
 
 	// timestamp
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
 	"gorm.io/gorm"
 )
 
@@ -38,14 +39,14 @@ type User struct {
 	Local           string     `json:"local,omitempty" gorm:"default:'en'"`
 
 	// books_count -- instead of counting the books a user have
-	// we can store it in a variable that should be updated by
-	// Book table GORM hooks
-	BooksCount uint `json:"books_count,omitempty"` // -- currently I'm not using it
+	// we store it here, kept up to date by the counter plugin
+	// (read only for gorm, see counter.Defaults)
+	BooksCount uint `json:"books_count,omitempty" gorm:"<-:false;not null;default:0"`
 
 	// timestamps
-	CreatedAt *time.Time      `json:"created_at,omitempty"`
-	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
-	DeletedAt *gorm.DeletedAt `json:"deleted_at,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	// UserProfile UserProfile `json:"user_profile" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
@@ -54,3 +55,20 @@ type User struct {
 	PreferredGenres []*Genre `json:"preferred_genres,omitempty" gorm:"many2many:user_preferred_genres"`
 	Books           []Book   `json:"books,omitempty" gorm:"foreignKey:OwnerID"`
 }
+
+// FilterSpec whitelists the fields user lists can be filtered and sorted by.
+func (User) FilterSpec() filter.Spec {
+	return filter.Spec{
+		Fields: map[string]filter.Field{
+			"email":             {Column: "email", Ops: []filter.Op{filter.OpEq, filter.OpLike}, Parse: filter.String},
+			"role":              {Column: "role", Ops: []filter.Op{filter.OpEq, filter.OpIn}, Parse: filter.Enum[Role]()},
+			"is_active":         {Column: "is_active", Ops: []filter.Op{filter.OpEq}, Parse: filter.Bool},
+			"email_verified_at": {Column: "email_verified_at", Ops: []filter.Op{filter.OpIsNull, filter.OpGte, filter.OpLte}, Parse: filter.Time},
+		},
+		Sort: map[string]string{
+			"email":       "email",
+			"created_at":  "created_at",
+			"books_count": "books_count",
+		},
+	}
+}
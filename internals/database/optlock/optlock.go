@@ -0,0 +1,178 @@
+// Package optlock adds optimistic concurrency control to models with a
+// Version field:
+//
+//	type Exchange struct {
+//		ID      uint
+//		Status  string
+//		Version optlock.Version `json:"version" gorm:"not null;default:1"`
+//	}
+//
+// Creating a row starts it at version 1. Updating a loaded row (Save,
+// Model(&ex).Updates(...), ...) adds `WHERE version = <loaded version>` and
+// bumps the version; if no row matched, someone else changed or deleted it
+// in the meantime and the update fails with *dberrors.ErrConflict instead of
+// silently overwriting their change:
+//
+//	db.First(&ex, id)
+//	ex.Status = "completed"
+//	if err := db.Save(&ex).Error; errors.As(err, new(*dberrors.ErrConflict)) {
+//		// reload and decide again
+//	}
+//
+// Bulk updates that don't start from a loaded row (Model(&Exchange{}).Where(...))
+// aren't guarded, but still bump the version of the rows they touch when
+// given a map, so that whoever loaded those rows before gets a conflict.
+package optlock
+
+import (
+	"reflect"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Version is the row version of an optimistically locked model.
+type Version uint
+
+var versionType = reflect.TypeOf(Version(0))
+
+// expectedKey holds the version a guarded update expects, for after-update.
+const expectedKey = "optlock:expected"
+
+// Plugin registers the optimistic locking callbacks:
+//
+//	db.Use(optlock.Plugin{})
+type Plugin struct{}
+
+func (Plugin) Name() string { return "optlock" }
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("optlock:before_create", beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("optlock:before_update", beforeUpdate); err != nil {
+		return err
+	}
+	return cb.Update().After("gorm:update").Register("optlock:after_update", afterUpdate)
+}
+
+func versionField(s *schema.Schema) *schema.Field {
+	if s == nil {
+		return nil
+	}
+	for _, f := range s.Fields {
+		if f.FieldType == versionType && f.DBName != "" {
+			return f
+		}
+	}
+	return nil
+}
+
+func beforeCreate(db *gorm.DB) {
+	field := versionField(db.Statement.Schema)
+	if db.Error != nil || field == nil {
+		return
+	}
+
+	// set it in memory too, the database default isn't read back
+	start := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); zero {
+			db.AddError(field.Set(db.Statement.Context, rv, Version(1)))
+		}
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Struct:
+		start(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			start(reflect.Indirect(rv.Index(i)))
+		}
+	}
+}
+
+func beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	field := versionField(stmt.Schema)
+	if db.Error != nil || field == nil {
+		return
+	}
+
+	current, ok := loadedVersion(stmt, field)
+	if !ok {
+		// not a loaded row, just bump the version of whatever gets updated
+		if _, isMap := stmt.Dest.(map[string]any); isMap {
+			stmt.SetColumn(field.DBName, clause.Expr{SQL: "? + 1", Vars: []any{clause.Column{Name: field.DBName}}}, true)
+			selectColumn(stmt, field)
+		}
+		return
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	stmt.SetColumn(field.DBName, current+1, true)
+	selectColumn(stmt, field)
+	db.InstanceSet(expectedKey, current)
+}
+
+func afterUpdate(db *gorm.DB) {
+	v, ok := db.InstanceGet(expectedKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	stmt := db.Statement
+	expected := v.(Version)
+
+	// the row wasn't updated, leave the caller's copy as it was. SetColumn
+	// only writes to the destination; when that is a map (Update,
+	// Updates(map[string]any{...})) gorm has copied the bumped version to
+	// the model, it goes back there too
+	field := versionField(stmt.Schema)
+	stmt.SetColumn(field.DBName, expected, true)
+	if _, isMap := stmt.Dest.(map[string]any); isMap && stmt.ReflectValue.Kind() == reflect.Struct && stmt.ReflectValue.CanAddr() {
+		db.AddError(field.Set(stmt.Context, stmt.ReflectValue, expected))
+	}
+
+	var id any
+	if pk := stmt.Schema.PrioritizedPrimaryField; pk != nil {
+		id, _ = pk.ValueOf(stmt.Context, stmt.ReflectValue)
+	}
+	db.AddError(&dberrors.ErrConflict{Entity: stmt.Schema.Name, ID: id, Version: uint(expected)})
+}
+
+// loadedVersion returns the version of the single, already persisted row
+// being updated.
+func loadedVersion(stmt *gorm.Statement, field *schema.Field) (Version, bool) {
+	rv := stmt.ReflectValue
+	if rv.Kind() != reflect.Struct || len(stmt.Schema.PrimaryFields) == 0 {
+		return 0, false
+	}
+	for _, pk := range stmt.Schema.PrimaryFields {
+		if _, zero := pk.ValueOf(stmt.Context, rv); zero {
+			return 0, false
+		}
+	}
+	v, zero := field.ValueOf(stmt.Context, rv)
+	if zero {
+		return 0, false
+	}
+	return v.(Version), true
+}
+
+// selectColumn makes sure an update restricted with Select still writes the
+// version.
+func selectColumn(stmt *gorm.Statement, field *schema.Field) {
+	if len(stmt.Selects) == 0 {
+		return
+	}
+	for _, s := range stmt.Selects {
+		if s == "*" || s == field.DBName || s == field.Name {
+			return
+		}
+	}
+	// copy, the slice may be shared with the *gorm.DB this one came from
+	stmt.Selects = append(stmt.Selects[:len(stmt.Selects):len(stmt.Selects)], field.DBName)
+}
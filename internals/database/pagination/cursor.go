@@ -0,0 +1,118 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a cursor can't be decoded or was issued
+// for a different sort order than the one it is used with.
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// cursor is the decoded form of the opaque string handed out to clients.
+// It carries the sort key values of a boundary row plus a fingerprint of the
+// keys, so a cursor from `-created_at` can't be replayed against `title`.
+type cursor struct {
+	Keys   string        `json:"k"`
+	Values []cursorValue `json:"v"`
+}
+
+// cursorValue keeps the Go kind next to the value, otherwise a time.Time
+// would come back from JSON as a plain string and compare as one.
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+func encodeCursor(keys []Key, values []any) (string, error) {
+	c := cursor{Keys: fingerprint(keys), Values: make([]cursorValue, len(values))}
+	for i, v := range values {
+		cv, err := toCursorValue(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor key %q: %w", keys[i].Column, err)
+		}
+		c.Values[i] = cv
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(keys []Key, s string) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Keys != fingerprint(keys) || len(c.Values) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]any, len(c.Values))
+	for i, cv := range c.Values {
+		v, err := fromCursorValue(cv)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func toCursorValue(v any) (cursorValue, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return cursorValue{}, errors.New("sort key is NULL")
+		}
+		rv = rv.Elem()
+	}
+
+	if t, ok := rv.Interface().(time.Time); ok {
+		return cursorValue{Type: "time", Value: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Type: "int", Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Type: "uint", Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Type: "float", Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.Bool:
+		return cursorValue{Type: "bool", Value: strconv.FormatBool(rv.Bool())}, nil
+	case reflect.String:
+		return cursorValue{Type: "string", Value: rv.String()}, nil
+	}
+	return cursorValue{}, fmt.Errorf("unsupported sort key type %s", rv.Type())
+}
+
+func fromCursorValue(cv cursorValue) (any, error) {
+	switch cv.Type {
+	case "time":
+		return time.Parse(time.RFC3339Nano, cv.Value)
+	case "int":
+		return strconv.ParseInt(cv.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(cv.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(cv.Value, 64)
+	case "bool":
+		return strconv.ParseBool(cv.Value)
+	case "string":
+		return cv.Value, nil
+	}
+	return nil, fmt.Errorf("unknown cursor value type %q", cv.Type)
+}
@@ -0,0 +1,244 @@
+// Package pagination implements keyset (cursor) pagination on top of any
+// *gorm.DB chain.
+//
+// Instead of OFFSET, a page is fetched by seeking past the sort key values of
+// the last row the client has seen, e.g. for `created_at DESC, id DESC`:
+//
+//	WHERE (created_at < ?) OR (created_at = ? AND id < ?)
+//	ORDER BY created_at DESC, id DESC LIMIT 21
+//
+// The boundary values travel to the client as an opaque cursor string.
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Key is a single sort column. Column is the database column name, optionally
+// qualified with a table (`messages.created_at`) for joined queries; an
+// unqualified column is resolved against the statement's own table.
+type Key struct {
+	Column string
+	Desc   bool
+}
+
+// Asc returns an ascending sort key.
+func Asc(column string) Key { return Key{Column: column} }
+
+// Desc returns a descending sort key.
+func Desc(column string) Key { return Key{Column: column, Desc: true} }
+
+// ParseSort turns a sort spec like "-created_at,title" into keys. A leading
+// "-" means descending. Only columns listed in allowed are accepted, so the
+// spec can come straight from a query string.
+func ParseSort(spec string, allowed ...string) ([]Key, error) {
+	var keys []Key
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := Asc(strings.TrimPrefix(part, "-"))
+		key.Desc = strings.HasPrefix(part, "-")
+		if !slices.Contains(allowed, key.Column) {
+			return nil, fmt.Errorf("pagination: can't sort by %q", key.Column)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k Key) column() clause.Column {
+	if table, name, ok := strings.Cut(k.Column, "."); ok {
+		return clause.Column{Table: table, Name: name}
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: k.Column}
+}
+
+func (k Key) name() string {
+	if _, name, ok := strings.Cut(k.Column, "."); ok {
+		return name
+	}
+	return k.Column
+}
+
+// fingerprint identifies a sort order, it is stored in every cursor.
+func fingerprint(keys []Key) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Column
+		if k.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Request is what a client sends to ask for a page. After and Before are the
+// cursors of a previously returned page and are mutually exclusive.
+type Request struct {
+	Limit  int    `json:"limit" query:"limit"`
+	After  string `json:"after" query:"after"`
+	Before string `json:"before" query:"before"`
+}
+
+func (r Request) limit() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultLimit
+	case r.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return r.Limit
+}
+
+// Page is a single page of results. NextCursor and PrevCursor are empty when
+// there is nothing further in that direction.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// Paginate runs the query in db ordered by keys and returns the page
+// described by req. The primary key `id` is appended as a tie-breaker when it
+// is not one of the keys, so the order is always total.
+//
+// db must not carry its own ORDER BY or LIMIT; filters, joins and preloads
+// are fine:
+//
+//	page, err := pagination.Paginate[models.Message](
+//		db.Where("thread_id = ?", threadID).Preload("Sender"),
+//		[]pagination.Key{pagination.Desc("created_at")},
+//		pagination.Request{After: cursor},
+//	)
+func Paginate[T any](db *gorm.DB, keys []Key, req Request) (*Page[T], error) {
+	if req.After != "" && req.Before != "" {
+		return nil, errors.New("pagination: after and before can't be used together")
+	}
+	keys = withTieBreaker(keys)
+	backward := req.Before != ""
+	limit := req.limit()
+
+	tx := db
+	if c := req.After + req.Before; c != "" {
+		values, err := decodeCursor(keys, c)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(seekCondition(keys, values, backward))
+	}
+	// walking backwards flips every key, the page is reversed afterwards
+	for _, k := range keys {
+		tx = tx.Order(clause.OrderByColumn{Column: k.column(), Desc: k.Desc != backward})
+	}
+
+	var items []T
+	if err := tx.Limit(limit + 1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+
+	page := &Page[T]{Items: items}
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	hasNext, hasPrev := hasMore, req.After != ""
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	values, err := keyValues(db, keys, items)
+	if err != nil {
+		return nil, err
+	}
+	if hasNext {
+		if page.NextCursor, err = encodeCursor(keys, values(len(items)-1)); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		if page.PrevCursor, err = encodeCursor(keys, values(0)); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func withTieBreaker(keys []Key) []Key {
+	desc := false
+	for _, k := range keys {
+		if k.name() == "id" {
+			return keys
+		}
+		desc = k.Desc
+	}
+	return append(slices.Clip(keys), Key{Column: "id", Desc: desc})
+}
+
+// seekCondition builds the row-value comparison "keys past values" as an
+// OR of ANDs, which, unlike `(a, b) > (?, ?)`, allows mixed directions.
+func seekCondition(keys []Key, values []any, backward bool) clause.Expression {
+	ors := make([]clause.Expression, 0, len(keys))
+	for i, k := range keys {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: keys[j].column(), Value: values[j]})
+		}
+		if k.Desc != backward {
+			ands = append(ands, clause.Lt{Column: k.column(), Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: k.column(), Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	// a lone OrConditions is glued to the previous WHERE with OR by GORM
+	if len(ors) == 1 {
+		return ors[0]
+	}
+	return clause.Or(ors...)
+}
+
+// keyValues resolves the sort keys against the schema of T and returns a
+// function reading the key values of the i-th item.
+func keyValues[T any](db *gorm.DB, keys []Key, items []T) (func(i int) []any, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, fmt.Errorf("pagination: failed to parse %T: %w", *new(T), err)
+	}
+
+	for _, k := range keys {
+		if stmt.Schema.LookUpField(k.name()) == nil {
+			return nil, fmt.Errorf("pagination: %s has no field for sort key %q", stmt.Schema.Name, k.Column)
+		}
+	}
+
+	return func(i int) []any {
+		rv := reflect.Indirect(reflect.ValueOf(&items[i]).Elem())
+		values := make([]any, len(keys))
+		for j, k := range keys {
+			values[j], _ = stmt.Schema.LookUpField(k.name()).ValueOf(db.Statement.Context, rv)
+		}
+		return values
+	}, nil
+}
@@ -0,0 +1,124 @@
+package projection
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDepth bounds how deep a field spec may nest relations.
+const maxDepth = 5
+
+// Field is one entry of a field spec. A Field with Children (or written as
+// `name()`) names a relation, otherwise it may be a column or a relation that
+// is loaded with all of its columns.
+type Field struct {
+	Name     string
+	Children Fields
+}
+
+// Fields is a parsed field spec such as `id,title,owner(id,email,user_profile(bio))`.
+type Fields []Field
+
+// SyntaxError reports a malformed field spec.
+type SyntaxError struct {
+	Spec   string
+	Offset int
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("projection: invalid fields %q at offset %d: %s", e.Spec, e.Offset, e.Reason)
+}
+
+// Parse parses a field spec. An empty spec yields no fields, which callers
+// treat as "everything".
+func Parse(spec string) (Fields, error) {
+	p := &parser{spec: spec}
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	fields, err := p.list(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.spec) {
+		return nil, p.errorf("unexpected %q", p.spec[p.pos])
+	}
+	return fields, nil
+}
+
+type parser struct {
+	spec string
+	pos  int
+}
+
+// list := item (',' item)*
+func (p *parser) list(depth int) (Fields, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("nested deeper than %d levels", maxDepth)
+	}
+
+	var fields Fields
+	for {
+		f, err := p.item(depth)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+
+		p.skipSpaces()
+		if p.pos >= len(p.spec) || p.spec[p.pos] != ',' {
+			return fields, nil
+		}
+		p.pos++
+	}
+}
+
+// item := ident ['(' list ')']
+func (p *parser) item(depth int) (Field, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.spec) && isIdent(p.spec[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return Field{}, p.errorf("expected a field name")
+	}
+	f := Field{Name: p.spec[start:p.pos]}
+
+	p.skipSpaces()
+	if p.pos < len(p.spec) && p.spec[p.pos] == '(' {
+		p.pos++
+		p.skipSpaces()
+		// `owner()` names the relation with all of its columns
+		f.Children = Fields{}
+		if p.pos < len(p.spec) && p.spec[p.pos] != ')' {
+			children, err := p.list(depth + 1)
+			if err != nil {
+				return Field{}, err
+			}
+			f.Children = children
+			p.skipSpaces()
+		}
+		if p.pos >= len(p.spec) || p.spec[p.pos] != ')' {
+			return Field{}, p.errorf("missing ')'")
+		}
+		p.pos++
+	}
+	return f, nil
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.spec) && p.spec[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Spec: p.spec, Offset: p.pos, Reason: fmt.Sprintf(format, args...)}
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,219 @@
+// Package projection turns sparse fieldsets into GORM Select and Preload
+// calls. Given
+//
+//	fields=id,title,owner(id,email,user_profile(bio))
+//
+// on a Book it produces the equivalent of
+//
+//	db.Select("id", "title", "owner_id").
+//		Preload("Owner", func(db *gorm.DB) *gorm.DB { return db.Select("id", "email") }).
+//		Preload("Owner.UserProfile", func(db *gorm.DB) *gorm.DB { return db.Select("id", "bio", "user_id") })
+//
+// Primary keys and the foreign keys a relation is joined on are always
+// selected, whether or not they were asked for, otherwise GORM can't stitch
+// the preloaded rows back onto their parents.
+package projection
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Error reports a field spec that doesn't fit the model.
+type Error struct {
+	Path   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("projection: %s: %s", e.Path, e.Reason)
+}
+
+// Plan is a projection resolved against a model.
+type Plan struct {
+	// Columns of the root model, nil selects every column.
+	Columns  []string
+	Preloads []Preload
+}
+
+// Preload is a relation to load, with the columns to select on it (nil
+// selects every column).
+type Preload struct {
+	Path    string
+	Columns []string
+}
+
+// Scope parses spec and resolves it against model in one go.
+func Scope(db *gorm.DB, model any, spec string) (func(*gorm.DB) *gorm.DB, error) {
+	fields, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := fields.Resolve(db, model)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Scope, nil
+}
+
+// Resolve matches the fields against the schema of model. Names match
+// either the JSON name or the column name of a field, and the JSON name or
+// snake_cased Go name of a relation; fields hidden from JSON can't be picked.
+func (f Fields) Resolve(db *gorm.DB, model any) (*Plan, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if len(f) == 0 {
+		return plan, nil
+	}
+	r := resolver{namer: db.NamingStrategy, plan: plan}
+	columns, err := r.resolve(stmt.Schema, f, "")
+	if err != nil {
+		return nil, err
+	}
+	plan.Columns = columns
+	return plan, nil
+}
+
+// Scope applies the plan to a query.
+func (p *Plan) Scope(db *gorm.DB) *gorm.DB {
+	if p.Columns != nil {
+		db = db.Select(p.Columns)
+	}
+	for _, pl := range p.Preloads {
+		if pl.Columns == nil {
+			db = db.Preload(pl.Path)
+			continue
+		}
+		columns := pl.Columns
+		db = db.Preload(pl.Path, func(db *gorm.DB) *gorm.DB {
+			return db.Select(columns)
+		})
+	}
+	return db
+}
+
+type resolver struct {
+	namer schema.Namer
+	plan  *Plan
+}
+
+func (r *resolver) resolve(s *schema.Schema, fields Fields, path string) ([]string, error) {
+	var columns []string
+	for _, pk := range s.PrimaryFields {
+		columns = appendUnique(columns, pk.DBName)
+	}
+
+	for _, f := range fields {
+		fieldPath := joinPath(path, f.Name)
+
+		if rel := r.relation(s, f.Name); rel != nil {
+			parentKeys, childKeys := joinKeys(rel)
+			columns = appendUnique(columns, parentKeys...)
+
+			preload := Preload{Path: joinPath(path, rel.Name)}
+			if len(f.Children) > 0 {
+				// the nested preloads are appended while resolving, keep the
+				// parent in front of them
+				idx := len(r.plan.Preloads)
+				r.plan.Preloads = append(r.plan.Preloads, preload)
+				childColumns, err := r.resolve(rel.FieldSchema, f.Children, preload.Path)
+				if err != nil {
+					return nil, err
+				}
+				r.plan.Preloads[idx].Columns = appendUnique(childColumns, childKeys...)
+				continue
+			}
+			r.plan.Preloads = append(r.plan.Preloads, preload)
+			continue
+		}
+
+		if f.Children != nil {
+			return nil, &Error{Path: fieldPath, Reason: "not a relation"}
+		}
+		field := lookUpField(s, f.Name)
+		if field == nil {
+			return nil, &Error{Path: fieldPath, Reason: "unknown field"}
+		}
+		columns = appendUnique(columns, field.DBName)
+	}
+	return columns, nil
+}
+
+func (r *resolver) relation(s *schema.Schema, name string) *schema.Relationship {
+	for _, rel := range s.Relationships.Relations {
+		if jsonName(rel.Field) == name || r.namer.ColumnName("", rel.Name) == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// joinKeys returns the columns the parent and the related model must select
+// for GORM to match them up.
+func joinKeys(rel *schema.Relationship) (parent, child []string) {
+	for _, ref := range rel.References {
+		if ref.PrimaryKey == nil {
+			continue
+		}
+		switch {
+		case rel.JoinTable != nil:
+			// many2many: both sides only need their own primary key, the
+			// foreign keys live in the join table
+			if ref.OwnPrimaryKey {
+				parent = append(parent, ref.PrimaryKey.DBName)
+			} else {
+				child = append(child, ref.PrimaryKey.DBName)
+			}
+		case ref.OwnPrimaryKey:
+			// has one / has many: child.fk = parent.pk
+			parent = append(parent, ref.PrimaryKey.DBName)
+			child = append(child, ref.ForeignKey.DBName)
+		default:
+			// belongs to: parent.fk = child.pk
+			parent = append(parent, ref.ForeignKey.DBName)
+			child = append(child, ref.PrimaryKey.DBName)
+		}
+	}
+	return parent, child
+}
+
+func lookUpField(s *schema.Schema, name string) *schema.Field {
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Readable || jsonName(field) == "-" {
+			continue
+		}
+		if jsonName(field) == name || field.DBName == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func jsonName(field *schema.Field) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func appendUnique(columns []string, names ...string) []string {
+	for _, n := range names {
+		if !slices.Contains(columns, n) {
+			columns = append(columns, n)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReplicaLag tells whether the server db is connected to is a replica and,
+// when it is, how far it lags behind its primary. lag is nil when the
+// replica can't tell, e.g. while replication is stopped.
+//
+// On MySQL/MariaDB this needs the REPLICATION CLIENT (SLAVE MONITOR on
+// MariaDB) privilege.
+func ReplicaLag(ctx context.Context, db *gorm.DB) (replica bool, lag *time.Duration, err error) {
+	db = db.WithContext(ctx)
+	switch name := db.Dialector.Name(); name {
+	case "mysql":
+		return mysqlReplicaLag(db)
+	case "postgres":
+		var row struct {
+			Replica bool
+			Seconds sql.NullFloat64
+		}
+		err := db.Raw("SELECT pg_is_in_recovery() AS replica, EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) AS seconds").
+			Scan(&row).Error
+		if err != nil || !row.Replica {
+			return false, nil, err
+		}
+		if row.Seconds.Valid {
+			d := time.Duration(row.Seconds.Float64 * float64(time.Second))
+			lag = &d
+		}
+		return true, lag, nil
+	default:
+		return false, nil, fmt.Errorf("replica lag: unsupported dialect %s", name)
+	}
+}
+
+func mysqlReplicaLag(db *gorm.DB) (bool, *time.Duration, error) {
+	rows, err := db.Raw("SHOW REPLICA STATUS").Rows()
+	if err != nil {
+		return false, nil, err
+	}
+	defer rows.Close()
+
+	// the columns differ between MariaDB and MySQL versions, only the
+	// seconds behind are read
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, nil, err
+	}
+	if !rows.Next() {
+		// no replication configured: not a replica
+		return false, nil, rows.Err()
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return true, nil, err
+	}
+	for i, column := range columns {
+		if !strings.EqualFold(column, "Seconds_Behind_Master") && !strings.EqualFold(column, "Seconds_Behind_Source") {
+			continue
+		}
+		if values[i] == nil {
+			return true, nil, nil
+		}
+		seconds, err := time.ParseDuration(string(values[i]) + "s")
+		if err != nil {
+			return true, nil, fmt.Errorf("replica lag: %w", err)
+		}
+		return true, &seconds, nil
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,100 @@
+package retention
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Action is what a policy does to the rows it is due for.
+type Action string
+
+const (
+	// ActionPurge hard deletes the rows, their cascade children and
+	// many-to-many links (see softdelete.Purge).
+	ActionPurge Action = "purge"
+	// ActionAnonymize overwrites personal data but keeps the (still
+	// trashed) row, for rows other data hangs on.
+	ActionAnonymize Action = "anonymize"
+)
+
+func (a Action) IsValid() bool {
+	switch a {
+	case ActionPurge, ActionAnonymize:
+		return true
+	}
+	return false
+}
+
+// Policy says what happens to the soft deleted rows of one model once they
+// have been in the trash for a while.
+type Policy struct {
+	// Name identifies the policy in results and in the activity log.
+	Name   string
+	Action Action
+	// After is how long a row stays in the trash untouched.
+	After time.Duration
+
+	model any
+	// pending narrows the due rows to the ones not handled yet
+	pending clause.Expression
+	apply   func(tx *gorm.DB, ids []uint) error
+}
+
+// Purge returns a policy hard deleting the T rows trashed for longer than
+// after.
+func Purge[T any](name string, after time.Duration) Policy {
+	return Policy{
+		Name:   name,
+		Action: ActionPurge,
+		After:  after,
+		model:  new(T),
+		apply: func(tx *gorm.DB, ids []uint) error {
+			return softdelete.Purge[T](tx, ids...)
+		},
+	}
+}
+
+// Anonymize returns a policy overwriting the columns in set on the T rows
+// trashed for longer than after. Values may be expressions evaluated per row,
+// e.g. gorm.Expr("CONCAT('deleted-', id)") for a unique column. Rows whose
+// columns already hold those values are left alone.
+func Anonymize[T any](name string, after time.Duration, set map[string]any) Policy {
+	columns := slices.Sorted(maps.Keys(set))
+	pending := make([]clause.Expression, len(columns))
+	for i, column := range columns {
+		pending[i] = clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: set[column]}
+	}
+	return Policy{
+		Name:   name,
+		Action: ActionAnonymize,
+		After:  after,
+		model:  new(T),
+		// And: a bare OrConditions would be OR-ed with the other conditions
+		pending: clause.And(clause.Or(pending...)),
+		apply: func(tx *gorm.DB, ids []uint) error {
+			// UpdateColumns: no hooks and no updated_at, the row is not
+			// being edited by anyone
+			return tx.Unscoped().Model(new(T)).
+				Where("id IN ?", ids).
+				UpdateColumns(set).Error
+		},
+	}
+}
+
+func (p Policy) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("retention: policy without a name")
+	case !p.Action.IsValid() || p.apply == nil:
+		return fmt.Errorf("retention: policy %s: use Purge or Anonymize to build it", p.Name)
+	case p.After <= 0:
+		return fmt.Errorf("retention: policy %s: After must be positive", p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+// Package retention gets rid of soft deleted rows once they have been in the
+// trash long enough.
+//
+// Each Policy covers one model: Purge hard deletes the rows (cascades and
+// many-to-many links included, see softdelete.Purge), Anonymize overwrites
+// their personal data and keeps them for the rows that still reference them.
+//
+//	engine, err := retention.New(db, retention.Defaults()...)
+//	results, err := engine.Run(ctx, retention.Options{DryRun: true})
+//
+// Rows are handled in small batches, each in its own short transaction, so a
+// run never holds more than BatchSize row locks at a time. A row that can't be
+// purged because something without a cascade still points at it is skipped
+// and counted, not failing the rest. Every policy run, dry runs included, is
+// recorded in the activity log.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultBatchSize = 500
+	day              = 24 * time.Hour
+)
+
+// Defaults are the retention policies of the application.
+func Defaults() []Policy {
+	return []Policy{
+		Purge[models.Notification]("notifications", 90*day),
+		Anonymize[models.Message]("messages", 365*day, map[string]any{
+			"body":        "",
+			"attachments": "[]",
+		}),
+		Purge[models.Book]("books", 180*day),
+		// users are referenced from everywhere (messages, ratings, reports),
+		// they are emptied rather than deleted; email and phone are unique
+		Anonymize[models.User]("users", 30*day, map[string]any{
+			"email":         gorm.Expr("CONCAT('deleted-', id, '@invalid')"),
+			"phone":         gorm.Expr("CONCAT('deleted-', id)"),
+			"password_hash": "",
+			"first_name":    nil,
+			"last_name":     nil,
+		}),
+	}
+}
+
+// Options tune a run.
+type Options struct {
+	// DryRun only counts the rows that are due.
+	DryRun bool
+	// BatchSize is the number of rows handled per transaction,
+	// DefaultBatchSize when zero.
+	BatchSize int
+	// Pause between batches, to leave the database some air on big runs.
+	Pause time.Duration
+}
+
+// Result is the outcome of one policy in a run.
+type Result struct {
+	Policy string    `json:"policy"`
+	Action Action    `json:"action"`
+	Table  string    `json:"table"`
+	Cutoff time.Time `json:"cutoff"`
+	DryRun bool      `json:"dry_run"`
+	// Due is the number of rows due when the run started.
+	Due int64 `json:"due"`
+	// Done is the number of rows purged or anonymized.
+	Done int64 `json:"done"`
+	// Skipped is the number of rows still referenced without a cascade.
+	Skipped int64         `json:"skipped"`
+	Batches int           `json:"batches"`
+	Took    time.Duration `json:"took"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Engine applies retention policies.
+type Engine struct {
+	db       *gorm.DB
+	policies []Policy
+}
+
+// New returns an Engine applying policies on db.
+func New(db *gorm.DB, policies ...Policy) (*Engine, error) {
+	for _, p := range policies {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Engine{db: db, policies: policies}, nil
+}
+
+// Run applies every policy once. A failing policy doesn't stop the others,
+// the returned error joins their errors.
+func (e *Engine) Run(ctx context.Context, opts Options) ([]Result, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	var errs []error
+	results := make([]Result, 0, len(e.policies))
+	for _, p := range e.policies {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		r, err := e.run(ctx, p, opts)
+		if err != nil {
+			r.Error = err.Error()
+			errs = append(errs, fmt.Errorf("retention: policy %s: %w", p.Name, err))
+		}
+		if err := e.record(ctx, r); err != nil {
+			errs = append(errs, fmt.Errorf("retention: recording policy %s: %w", p.Name, err))
+		}
+		results = append(results, r)
+	}
+	return results, errors.Join(errs...)
+}
+
+// Schedule runs the policies every interval until ctx is done, handing each
+// run's outcome to report.
+func (e *Engine) Schedule(ctx context.Context, every time.Duration, opts Options, report func([]Result, error)) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		report(e.Run(ctx, opts))
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (e *Engine) run(ctx context.Context, p Policy, opts Options) (r Result, err error) {
+	start := time.Now()
+	db := e.db.WithContext(ctx)
+	r = Result{Policy: p.Name, Action: p.Action, DryRun: opts.DryRun, Cutoff: db.NowFunc().Add(-p.After)}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(p.model); err != nil {
+		return r, err
+	}
+	r.Table = stmt.Schema.Table
+
+	due := func(tx *gorm.DB) *gorm.DB {
+		deletedAt := clause.Column{Table: clause.CurrentTable, Name: "deleted_at"}
+		q := tx.Unscoped().Model(p.model).
+			Where(clause.Neq{Column: deletedAt, Value: nil}).
+			Where(clause.Lte{Column: deletedAt, Value: r.Cutoff})
+		if p.pending != nil {
+			q = q.Where(p.pending)
+		}
+		return q
+	}
+
+	defer func() { r.Took = time.Since(start) }()
+	if err := due(db).Count(&r.Due).Error; err != nil {
+		return r, err
+	}
+	if opts.DryRun || r.Due == 0 {
+		return r, nil
+	}
+
+	// walk up the ids, so skipped rows (and anonymized ones still matching)
+	// aren't picked again
+	var last uint
+	for {
+		var ids []uint
+		var done, skipped int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := due(tx).
+				Where(clause.Gt{Column: clause.PrimaryColumn, Value: last}).
+				Order(clause.OrderByColumn{Column: clause.PrimaryColumn}).
+				Limit(opts.BatchSize).
+				// keeps a concurrent restore from slipping in between
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			last = ids[len(ids)-1]
+
+			var err error
+			done, skipped, err = apply(tx, p, ids)
+			return err
+		})
+		if err != nil {
+			return r, err
+		}
+		r.Done += done
+		r.Skipped += skipped
+		if len(ids) == 0 {
+			return r, nil
+		}
+		r.Batches++
+
+		if len(ids) < opts.BatchSize {
+			return r, nil
+		}
+		if opts.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return r, ctx.Err()
+			case <-time.After(opts.Pause):
+			}
+		}
+	}
+}
+
+// apply runs the policy on a batch, falling back to one row at a time when a
+// row in it is still referenced.
+func apply(tx *gorm.DB, p Policy, ids []uint) (done, skipped int64, err error) {
+	// savepoints, a failed attempt doesn't spoil the batch transaction
+	err = tx.Transaction(func(tx *gorm.DB) error { return p.apply(tx, ids) })
+	if err == nil {
+		return int64(len(ids)), 0, nil
+	}
+	var fk *dberrors.ErrForeignKey
+	if !errors.As(err, &fk) {
+		return 0, 0, err
+	}
+
+	for _, id := range ids {
+		err := tx.Transaction(func(tx *gorm.DB) error { return p.apply(tx, []uint{id}) })
+		switch {
+		case err == nil:
+			done++
+		case errors.As(err, &fk):
+			skipped++
+		default:
+			return done, skipped, err
+		}
+	}
+	return done, skipped, nil
+}
+
+// record writes the result of a policy run to the activity log.
+func (e *Engine) record(ctx context.Context, r Result) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	action := models.LogActionDelete
+	if r.Action == ActionAnonymize {
+		action = models.LogActionUpdate
+	}
+	return e.db.WithContext(ctx).Create(&models.ActivityLog{
+		Action:     action,
+		ObjectType: r.Table,
+		Payload:    string(payload),
+	}).Error
+}
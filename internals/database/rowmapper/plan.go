@@ -0,0 +1,172 @@
+package rowmapper
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// Separator splits a column alias into a field path: `owner__user_profile__bio`
+// is T.Owner.UserProfile.Bio.
+const Separator = "__"
+
+var naming = schema.NamingStrategy{}
+
+type nodeKind int
+
+const (
+	kindRoot      nodeKind = iota
+	kindStruct             // Profile
+	kindStructPtr          // *Profile
+	kindSlice              // []Genre
+	kindSlicePtr           // []*Genre
+)
+
+// node is a struct in the target type that at least one column maps into.
+type node struct {
+	kind     nodeKind
+	typ      reflect.Type // the struct type
+	index    []int        // field index in the parent struct
+	columns  []binding
+	children []*node
+	// keys are the positions in columns identifying one struct, the
+	// primary key when it was selected
+	keys []int
+}
+
+// binding ties a result column to a field of a node.
+type binding struct {
+	column int
+	index  []int
+	typ    reflect.Type
+}
+
+// buildPlan maps every column onto the struct tree rooted at typ.
+func buildPlan(typ reflect.Type, columns []string) (*node, error) {
+	root := &node{kind: kindRoot, typ: typ}
+	for i, col := range columns {
+		if err := root.bind(i, col, strings.Split(col, Separator)); err != nil {
+			return nil, err
+		}
+	}
+	root.resolveKeys()
+	return root, nil
+}
+
+func (n *node) bind(column int, alias string, path []string) error {
+	field, ok := lookUpField(n.typ, path[0])
+	if !ok {
+		return fmt.Errorf("rowmapper: column %q has no matching field %q in %s", alias, path[0], n.typ)
+	}
+
+	if len(path) == 1 {
+		n.columns = append(n.columns, binding{column: column, index: field.Index, typ: field.Type})
+		return nil
+	}
+
+	child := n.child(field)
+	if child == nil {
+		return fmt.Errorf("rowmapper: column %q: field %s.%s is not a struct or slice of structs", alias, n.typ, field.Name)
+	}
+	return child.bind(column, alias, path[1:])
+}
+
+func (n *node) child(field reflect.StructField) *node {
+	for _, c := range n.children {
+		if slices.Equal(c.index, field.Index) {
+			return c
+		}
+	}
+
+	c := &node{index: field.Index}
+	t := field.Type
+	switch {
+	case t.Kind() == reflect.Struct:
+		c.kind, c.typ = kindStruct, t
+	case t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct:
+		c.kind, c.typ = kindStructPtr, t.Elem()
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+		c.kind, c.typ = kindSlice, t.Elem()
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Pointer && t.Elem().Elem().Kind() == reflect.Struct:
+		c.kind, c.typ = kindSlicePtr, t.Elem().Elem()
+	default:
+		return nil
+	}
+	n.children = append(n.children, c)
+	return c
+}
+
+// resolveKeys picks the identity columns of every node. A struct is keyed by
+// its primary key when selected; otherwise slice elements are keyed by all
+// of their columns, and root rows aren't grouped at all.
+func (n *node) resolveKeys() {
+	for i, b := range n.columns {
+		if isPrimaryKey(n.typ.FieldByIndex(b.index)) {
+			n.keys = append(n.keys, i)
+		}
+	}
+	if len(n.keys) == 0 && (n.kind == kindSlice || n.kind == kindSlicePtr) {
+		for i := range n.columns {
+			n.keys = append(n.keys, i)
+		}
+	}
+	for _, c := range n.children {
+		c.resolveKeys()
+	}
+}
+
+// lookUpField finds the field a path segment refers to. A segment matches the
+// gorm column name, the JSON name, the snake_cased Go name or the Go name
+// itself, case-insensitively. Fields of embedded structs (gorm.Model) are
+// promoted like in Go.
+func lookUpField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Anonymous || indexThroughPointer(typ, f.Index) {
+			continue
+		}
+		for _, candidate := range fieldNames(f) {
+			if strings.EqualFold(candidate, name) {
+				return f, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func fieldNames(f reflect.StructField) []string {
+	names := []string{f.Name, naming.ColumnName("", f.Name)}
+	if json, _, _ := strings.Cut(f.Tag.Get("json"), ","); json != "" && json != "-" {
+		names = append(names, json)
+	}
+	if col := schema.ParseTagSetting(f.Tag.Get("gorm"), ";")["COLUMN"]; col != "" {
+		names = append(names, col)
+	}
+	return names
+}
+
+func isPrimaryKey(f reflect.StructField) bool {
+	settings := schema.ParseTagSetting(f.Tag.Get("gorm"), ";")
+	if _, ok := settings["PRIMARYKEY"]; ok {
+		return true
+	}
+	if _, ok := settings["PRIMARY_KEY"]; ok {
+		return true
+	}
+	return f.Name == "ID"
+}
+
+// indexThroughPointer reports whether reaching the field goes through an
+// embedded pointer, which FieldByIndex can't allocate.
+func indexThroughPointer(typ reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		f := typ.Field(i)
+		if f.Type.Kind() == reflect.Pointer {
+			return true
+		}
+		typ = f.Type
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+// Package rowmapper scans *sql.Rows into nested structs by column alias.
+//
+// Unlike util.CollectFieldPtrs, which scans by struct field order, columns are
+// matched by name, and `__` in an alias walks into nested structs:
+//
+//	SELECT books.id, books.title,
+//	       users.email           AS owner__email,
+//	       user_profiles.bio     AS owner__user_profile__bio,
+//	       genres.id             AS genres__id,
+//	       genres.name           AS genres__name
+//	FROM books JOIN ...
+//
+// scans into
+//
+//	type Row struct {
+//		ID     uint
+//		Title  string
+//		Owner  *struct{ Email string; UserProfile struct{ Bio *string } }
+//		Genres []struct{ ID uint; Name string }
+//	}
+//
+// Rows sharing the same root primary key are merged, so the one-to-many
+// `genres` join yields one Row per book with all of its genres. NULLs leave
+// pointers nil and other fields at their zero value, and a nested struct whose
+// columns are all NULL (an unmatched LEFT JOIN) is skipped entirely.
+package rowmapper
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Find runs the query built on db and scans its rows into T.
+func Find[T any](db *gorm.DB) ([]T, error) {
+	rows, err := db.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return Scan[T](rows)
+}
+
+// Scan reads all remaining rows into T, which must be a struct type. The
+// caller still owns (and closes) rows.
+func Scan[T any](rows *sql.Rows) ([]T, error) {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("rowmapper: can't scan into %s, expected a struct", typ)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := buildPlan(typ, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	holders := make([]reflect.Value, len(columns))
+	dest := make([]any, len(columns))
+	plan.walk(func(b binding) {
+		// scan into a pointer to the field type, database/sql sets it to nil
+		// on NULL instead of failing
+		if b.typ.Kind() == reflect.Pointer {
+			holders[b.column] = reflect.New(b.typ)
+		} else {
+			holders[b.column] = reflect.New(reflect.PointerTo(b.typ))
+		}
+		dest[b.column] = holders[b.column].Interface()
+	})
+
+	roots := &group{}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		plan.visit(roots, holders)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]T, len(roots.items))
+	for i, inst := range roots.items {
+		plan.materialize(inst)
+		result[i] = inst.ptr.Elem().Interface().(T)
+	}
+	return result, nil
+}
+
+// group collects the distinct structs a node produced under one parent.
+type group struct {
+	items []*instance
+	byKey map[string]*instance
+}
+
+type instance struct {
+	ptr    reflect.Value // pointer to the struct
+	groups []*group      // one per child node
+}
+
+func (n *node) walk(fn func(binding)) {
+	for _, b := range n.columns {
+		fn(b)
+	}
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// visit merges the current row into g.
+func (n *node) visit(g *group, holders []reflect.Value) {
+	if n.kind != kindRoot && n.allNull(holders) {
+		return
+	}
+
+	var inst *instance
+	var key string
+	switch {
+	case n.kind == kindStruct || n.kind == kindStructPtr:
+		if len(g.items) > 0 {
+			inst = g.items[0]
+		}
+	case len(n.keys) > 0:
+		key = n.key(holders)
+		inst = g.byKey[key]
+	}
+
+	if inst == nil {
+		inst = n.newInstance(holders)
+		g.items = append(g.items, inst)
+		if len(n.keys) > 0 {
+			if g.byKey == nil {
+				g.byKey = map[string]*instance{}
+			}
+			g.byKey[key] = inst
+		}
+	}
+
+	for i, c := range n.children {
+		c.visit(inst.groups[i], holders)
+	}
+}
+
+func (n *node) newInstance(holders []reflect.Value) *instance {
+	inst := &instance{ptr: reflect.New(n.typ), groups: make([]*group, len(n.children))}
+	for i := range inst.groups {
+		inst.groups[i] = &group{}
+	}
+
+	for _, b := range n.columns {
+		v := holders[b.column].Elem()
+		if v.IsNil() {
+			continue
+		}
+		if b.typ.Kind() != reflect.Pointer {
+			v = v.Elem()
+		}
+		inst.ptr.Elem().FieldByIndex(b.index).Set(v)
+	}
+	return inst
+}
+
+// materialize copies the collected children into the struct of inst. Children
+// are completed first, copying a struct copies its slice headers.
+func (n *node) materialize(inst *instance) {
+	for i, c := range n.children {
+		items := inst.groups[i].items
+		if len(items) == 0 {
+			continue
+		}
+		for _, item := range items {
+			c.materialize(item)
+		}
+
+		field := inst.ptr.Elem().FieldByIndex(c.index)
+		switch c.kind {
+		case kindStruct:
+			field.Set(items[0].ptr.Elem())
+		case kindStructPtr:
+			field.Set(items[0].ptr)
+		case kindSlice, kindSlicePtr:
+			s := reflect.MakeSlice(field.Type(), 0, len(items))
+			for _, item := range items {
+				if c.kind == kindSlice {
+					s = reflect.Append(s, item.ptr.Elem())
+				} else {
+					s = reflect.Append(s, item.ptr)
+				}
+			}
+			field.Set(s)
+		}
+	}
+}
+
+func (n *node) allNull(holders []reflect.Value) bool {
+	null := true
+	n.walk(func(b binding) {
+		if !holders[b.column].Elem().IsNil() {
+			null = false
+		}
+	})
+	return null
+}
+
+func (n *node) key(holders []reflect.Value) string {
+	parts := make([]string, len(n.keys))
+	for i, k := range n.keys {
+		v := holders[n.columns[k].column].Elem()
+		if v.IsNil() {
+			parts[i] = "\x00"
+			continue
+		}
+		parts[i] = fmt.Sprint(reflect.Indirect(v.Elem()).Interface())
+	}
+	return strings.Join(parts, "\x1f")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -164,27 +165,32 @@ func seedLocations(db *gorm.DB, ctx context.Context) error {
 
 // seedUsers creates diverse users with different roles, subscription statuses, and profiles
 func seedUsers(db *gorm.DB, ctx context.Context) ([]models.User, error) {
+	// every seeded user logs in with "password"
+	password, err := auth.HashPassword("password")
+	if err != nil {
+		return nil, err
+	}
 	users := []models.User{
 		// Active users with different roles
-		{Email: "john.doe@example.com", Phone: "15551230001", PasswordHash: "password", FirstName: "John", LastName: "Doe", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -30))},
-		{Email: "jane.smith@example.com", Phone: "15551230002", PasswordHash: "password", FirstName: "Jane", LastName: "Smith", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -15))},
-		{Email: "bob.wilson@example.com", Phone: "15551230003", PasswordHash: "password", FirstName: "Bob", LastName: "Wilson", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -7))},
-		{Email: "alice.brown@example.com", Phone: "15551230004", PasswordHash: "password", FirstName: "Alice", LastName: "Brown", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -45))},
-		{Email: "charlie.davis@example.com", Phone: "15551230005", PasswordHash: "password", FirstName: "Charlie", LastName: "Davis", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -20))},
+		{Email: "john.doe@example.com", Phone: "15551230001", PasswordHash: password, FirstName: "John", LastName: "Doe", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -30))},
+		{Email: "jane.smith@example.com", Phone: "15551230002", PasswordHash: password, FirstName: "Jane", LastName: "Smith", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -15))},
+		{Email: "bob.wilson@example.com", Phone: "15551230003", PasswordHash: password, FirstName: "Bob", LastName: "Wilson", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -7))},
+		{Email: "alice.brown@example.com", Phone: "15551230004", PasswordHash: password, FirstName: "Alice", LastName: "Brown", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -45))},
+		{Email: "charlie.davis@example.com", Phone: "15551230005", PasswordHash: password, FirstName: "Charlie", LastName: "Davis", IsActive: true, Role: models.RoleUser, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -20))},
 
 		// Admin and moderator users
-		{Email: "admin@example.com", Phone: "15551230006", PasswordHash: "password", FirstName: "Ada", LastName: "Admin", IsActive: true, Role: models.RoleAdmin, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -60))},
-		{Email: "moderator@example.com", Phone: "15551230007", PasswordHash: "password", FirstName: "Mike", LastName: "Moderator", IsActive: true, Role: models.RoleModerator, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -40))},
+		{Email: "admin@example.com", Phone: "15551230006", PasswordHash: password, FirstName: "Ada", LastName: "Admin", IsActive: true, Role: models.RoleAdmin, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -60))},
+		{Email: "moderator@example.com", Phone: "15551230007", PasswordHash: password, FirstName: "Mike", LastName: "Moderator", IsActive: true, Role: models.RoleModerator, Local: "en", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -40))},
 
 		// Inactive users
-		{Email: "inactive@example.com", Phone: "15551230008", PasswordHash: "password", FirstName: "Inactive", LastName: "User", IsActive: false, Role: models.RoleUser, Local: "en"},
+		{Email: "inactive@example.com", Phone: "15551230008", PasswordHash: password, FirstName: "Inactive", LastName: "User", IsActive: false, Role: models.RoleUser, Local: "en"},
 
 		// Users with unverified emails
-		{Email: "unverified@example.com", Phone: "15551230009", PasswordHash: "password", FirstName: "Unverified", LastName: "User", IsActive: true, Role: models.RoleUser, Local: "en"},
+		{Email: "unverified@example.com", Phone: "15551230009", PasswordHash: password, FirstName: "Unverified", LastName: "User", IsActive: true, Role: models.RoleUser, Local: "en"},
 
 		// Users with different locales
-		{Email: "french.user@example.com", Phone: "15551230010", PasswordHash: "password", FirstName: "Pierre", LastName: "Dupont", IsActive: true, Role: models.RoleUser, Local: "fr", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -10))},
-		{Email: "german.user@example.com", Phone: "15551230011", PasswordHash: "password", FirstName: "Hans", LastName: "Mueller", IsActive: true, Role: models.RoleUser, Local: "de", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -25))},
+		{Email: "french.user@example.com", Phone: "15551230010", PasswordHash: password, FirstName: "Pierre", LastName: "Dupont", IsActive: true, Role: models.RoleUser, Local: "fr", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -10))},
+		{Email: "german.user@example.com", Phone: "15551230011", PasswordHash: password, FirstName: "Hans", LastName: "Mueller", IsActive: true, Role: models.RoleUser, Local: "de", EmailVerifiedAt: timePtr(time.Now().AddDate(0, 0, -25))},
 	}
 
 	for i := range users {
@@ -383,12 +389,12 @@ func seedBooks(db *gorm.DB, ctx context.Context, users []models.User, authors []
 func seedSubscriptions(db *gorm.DB, ctx context.Context, users []models.User) ([]models.Subscription, error) {
 	// Create subscription plans
 	plans := []models.SubscriptionPlan{
-		{Slug: "free", Name: "Free", PriceCents: 0, Currency: "USD", Interval: "month", Active: true},
-		{Slug: "basic", Name: "Basic", PriceCents: 999, Currency: "USD", Interval: "month", Active: true},
-		{Slug: "premium", Name: "Premium", PriceCents: 1999, Currency: "USD", Interval: "month", Active: true},
-		{Slug: "enterprise", Name: "Enterprise", PriceCents: 4999, Currency: "USD", Interval: "month", Active: true},
-		{Slug: "annual-basic", Name: "Basic Annual", PriceCents: 9999, Currency: "USD", Interval: "year", Active: true},
-		{Slug: "annual-premium", Name: "Premium Annual", PriceCents: 19999, Currency: "USD", Interval: "year", Active: true},
+		{Slug: "free", Name: "Free", PriceCents: 0, Currency: "USD", Interval: "month", Active: true, Features: features(`{"max_books": 5, "paid_chat": false}`)},
+		{Slug: "basic", Name: "Basic", PriceCents: 999, Currency: "USD", Interval: "month", Active: true, Features: features(`{"max_books": 25, "paid_chat": true}`)},
+		{Slug: "premium", Name: "Premium", PriceCents: 1999, Currency: "USD", Interval: "month", Active: true, Features: features(`{"max_books": 100, "paid_chat": true, "priority_support": true}`)},
+		{Slug: "enterprise", Name: "Enterprise", PriceCents: 4999, Currency: "USD", Interval: "month", Active: true, Features: features(`{"max_books": null, "paid_chat": true, "priority_support": true}`)},
+		{Slug: "annual-basic", Name: "Basic Annual", PriceCents: 9999, Currency: "USD", Interval: "year", Active: true, Features: features(`{"max_books": 25, "paid_chat": true}`)},
+		{Slug: "annual-premium", Name: "Premium Annual", PriceCents: 19999, Currency: "USD", Interval: "year", Active: true, Features: features(`{"max_books": 100, "paid_chat": true, "priority_support": true}`)},
 		{Slug: "inactive-plan", Name: "Inactive Plan", PriceCents: 999, Currency: "USD", Interval: "month", Active: false},
 	}
 
@@ -420,6 +426,11 @@ func seedSubscriptions(db *gorm.DB, ctx context.Context, users []models.User) ([
 	return subscriptions, nil
 }
 
+// features is the JSON features of a plan, null meaning unlimited
+func features(s string) datatypes.JSON {
+	return datatypes.JSON(s)
+}
+
 // Helper function to create string pointers
 func stringPtr(s string) *string {
 	return &s
@@ -486,24 +497,25 @@ func seedCommunities(db *gorm.DB, ctx context.Context, users []models.User) ([]m
 		}
 	}
 
-	// Create community memberships
+	// Create community memberships, creators administer their communities
+	admin, moderator := models.CommunityRoleAdmin, models.CommunityRoleModerator
 	memberships := []models.CommunityMember{
-		{CommunityID: communities[0].ID, UserID: users[0].ID},
+		{CommunityID: communities[0].ID, UserID: users[0].ID, CommunityRole: admin},
 		{CommunityID: communities[0].ID, UserID: users[1].ID},
 		{CommunityID: communities[0].ID, UserID: users[2].ID},
-		{CommunityID: communities[1].ID, UserID: users[1].ID},
+		{CommunityID: communities[1].ID, UserID: users[1].ID, CommunityRole: admin},
 		{CommunityID: communities[1].ID, UserID: users[4].ID},
-		{CommunityID: communities[2].ID, UserID: users[2].ID},
+		{CommunityID: communities[2].ID, UserID: users[2].ID, CommunityRole: admin},
 		{CommunityID: communities[2].ID, UserID: users[3].ID},
-		{CommunityID: communities[3].ID, UserID: users[3].ID},
+		{CommunityID: communities[3].ID, UserID: users[3].ID, CommunityRole: admin},
 		{CommunityID: communities[3].ID, UserID: users[0].ID},
-		{CommunityID: communities[4].ID, UserID: users[4].ID},
+		{CommunityID: communities[4].ID, UserID: users[4].ID, CommunityRole: admin},
 		{CommunityID: communities[4].ID, UserID: users[1].ID},
-		{CommunityID: communities[5].ID, UserID: users[5].ID},
-		{CommunityID: communities[5].ID, UserID: users[6].ID},
-		{CommunityID: communities[6].ID, UserID: users[6].ID},
+		{CommunityID: communities[5].ID, UserID: users[5].ID, CommunityRole: admin},
+		{CommunityID: communities[5].ID, UserID: users[6].ID, CommunityRole: moderator},
+		{CommunityID: communities[6].ID, UserID: users[6].ID, CommunityRole: admin},
 		{CommunityID: communities[6].ID, UserID: users[2].ID},
-		{CommunityID: communities[7].ID, UserID: users[0].ID},
+		{CommunityID: communities[7].ID, UserID: users[0].ID, CommunityRole: admin},
 		{CommunityID: communities[7].ID, UserID: users[1].ID},
 		{CommunityID: communities[7].ID, UserID: users[2].ID},
 		{CommunityID: communities[7].ID, UserID: users[3].ID},
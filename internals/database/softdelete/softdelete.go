@@ -0,0 +1,390 @@
+// Package softdelete implements the soft delete policy of the models.
+//
+// Every model soft deletes through a `DeletedAt gorm.DeletedAt` column (own
+// field or embedded gorm.Model), so the default scope hides trashed rows from
+// queries, preloads included, and Unscoped sees them. Flags such as
+// Book.ArchivedAt or Exchange.Archived are business state, not deletion: an
+// archived row is still listed where the caller asks for it.
+//
+// The column is tagged `json:"-"`, the API only serves live rows. Unlike the
+// former *gorm.DeletedAt, a gorm.DeletedAt is a struct that omitempty can't
+// leave out, and every response would carry "deleted_at": null; with the tag
+// deleted_at is no longer in any response, trashed rows included.
+//
+// Deleting a row through this package cascades to its children the same way
+// the database does on a hard delete: has-one and has-many relations declared
+// with `constraint:OnDelete:CASCADE` (on either side) are trashed with the
+// same deleted_at as their parent, recursively, so that Restore can bring back
+// exactly what went away with it and nothing that was trashed on its own.
+// Many-to-many links (a book's genres) are kept while trashed and removed on
+// Purge. They are no children: a link row has no deleted_at, so Restore
+// couldn't tell the links trashed with the row from those removed before,
+// and every query reaching a trashed row through a link (a genre's books)
+// goes through the row's default scope and doesn't see it anyway.
+//
+//	softdelete.Delete[models.Book](db, id)  // book, images and reviews to the trash
+//	softdelete.Restore[models.Book](db, id) // all of them back
+//	softdelete.Purge[models.Book](db, id)   // gone for good, genre links too
+package softdelete
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotSoftDeletable is returned for models without a gorm.DeletedAt field.
+var ErrNotSoftDeletable = errors.New("softdelete: model has no gorm.DeletedAt field")
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// Delete moves the T rows with the given ids, and their cascade children, to
+// the trash. Rows already trashed are left alone.
+func Delete[T any](db *gorm.DB, ids ...uint) error {
+	m, err := parse[T](db)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// one timestamp for the whole cascade, Restore matches on it
+		now := tx.NowFunc()
+		tx = tx.Session(&gorm.Session{NowFunc: func() time.Time { return now }})
+
+		// children of a row that is already in the trash stay where they are
+		var live []uint
+		if err := tx.Model(m.new()).
+			Where(clause.IN{Column: m.column(m.pk), Values: values(ids)}).
+			Pluck(m.pk.DBName, &live).Error; err != nil {
+			return err
+		}
+		return m.trash(tx, live)
+	})
+}
+
+// Restore takes the T rows with the given ids out of the trash, together with
+// the children that were trashed along with them. It fails with
+// *dberrors.ErrNotFound unless all of the ids are in the trash.
+func Restore[T any](db *gorm.DB, ids ...uint) error {
+	m, err := parse[T](db)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		rows, err := m.trashed(tx, ids)
+		if err != nil {
+			return err
+		}
+
+		// rows trashed at different times cascaded to different children
+		byTime := map[time.Time][]uint{}
+		for _, r := range rows {
+			byTime[r.at] = append(byTime[r.at], r.id)
+		}
+		for at, ids := range byTime {
+			if err := m.restore(tx, ids, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListTrashed returns the trashed T rows matching the conditions already on
+// db, most recently deleted first.
+func ListTrashed[T any](db *gorm.DB) ([]T, error) {
+	m, err := parse[T](db)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []T
+	err = db.Unscoped().
+		Where(clause.Neq{Column: m.column(m.deletedAt), Value: nil}).
+		Order(clause.OrderByColumn{Column: m.column(m.deletedAt), Desc: true}).
+		Find(&items).Error
+	return items, err
+}
+
+// Purge permanently deletes the trashed T rows with the given ids, along with
+// all of their cascade children, trashed or not, and their many-to-many
+// links. It fails with *dberrors.ErrNotFound unless all of the ids are in the
+// trash: a live row has to be deleted first.
+func Purge[T any](db *gorm.DB, ids ...uint) error {
+	m, err := parse[T](db)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := m.trashed(tx, ids); err != nil {
+			return err
+		}
+		return m.purge(tx, ids)
+	})
+}
+
+// model is the part of a schema the soft delete operations need.
+type model struct {
+	*schema.Schema
+	pk        *schema.Field
+	deletedAt *schema.Field
+}
+
+func parse[T any](db *gorm.DB) (*model, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	m := modelOf(stmt.Schema)
+	if m.pk == nil {
+		return nil, fmt.Errorf("softdelete: %s has no single primary key", m.Name)
+	}
+	if m.deletedAt == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotSoftDeletable, m.Name)
+	}
+	return m, nil
+}
+
+func modelOf(s *schema.Schema) *model {
+	m := &model{Schema: s}
+	if len(s.PrimaryFields) == 1 {
+		m.pk = s.PrimaryFields[0]
+	}
+	for _, f := range s.Fields {
+		if f.IndirectFieldType == deletedAtType && f.DBName != "" {
+			m.deletedAt = f
+			break
+		}
+	}
+	return m
+}
+
+func (m *model) new() any { return reflect.New(m.ModelType).Interface() }
+
+func (m *model) column(f *schema.Field) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: f.DBName}
+}
+
+type trashedRow struct {
+	id uint
+	at time.Time
+}
+
+// trashed returns the ids with their deleted_at, all of ids must be trashed.
+func (m *model) trashed(tx *gorm.DB, ids []uint) ([]trashedRow, error) {
+	rows, err := tx.Unscoped().Model(m.new()).
+		Select([]string{m.pk.DBName, m.deletedAt.DBName}).
+		Where(clause.IN{Column: m.column(m.pk), Values: values(ids)}).
+		Where(clause.Neq{Column: m.column(m.deletedAt), Value: nil}).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []trashedRow
+	for rows.Next() {
+		var r trashedRow
+		if err := rows.Scan(&r.id, &r.at); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) < len(unique(ids)) {
+		return nil, &dberrors.ErrNotFound{Entity: m.Name}
+	}
+	return result, nil
+}
+
+func (m *model) trash(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, c := range m.cascades() {
+		if c.deletedAt == nil {
+			// nothing to trash it with, the database cascade takes care of
+			// it on purge
+			continue
+		}
+		childIDs, err := c.ids(tx, ids)
+		if err != nil {
+			return err
+		}
+		if err := c.trash(tx, childIDs); err != nil {
+			return err
+		}
+	}
+	// a soft delete, through the delete callbacks and hooks
+	return tx.Where(clause.IN{Column: m.column(m.pk), Values: values(ids)}).Delete(m.new()).Error
+}
+
+func (m *model) restore(tx *gorm.DB, ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, c := range m.cascades() {
+		if c.deletedAt == nil {
+			continue
+		}
+		childIDs, err := c.ids(tx.Unscoped().Where(clause.Eq{Column: c.column(c.deletedAt), Value: at}), ids)
+		if err != nil {
+			return err
+		}
+		if err := c.restore(tx, childIDs, at); err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Model(m.new()).
+		Where(clause.IN{Column: m.column(m.pk), Values: values(ids)}).
+		Where(clause.Eq{Column: m.column(m.deletedAt), Value: at}).
+		Update(m.deletedAt.DBName, nil).Error
+}
+
+func (m *model) purge(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, c := range m.cascades() {
+		childIDs, err := c.ids(tx.Unscoped(), ids)
+		if err != nil {
+			return err
+		}
+		if err := c.purge(tx, childIDs); err != nil {
+			return err
+		}
+	}
+	for _, rel := range m.Relationships.Many2Many {
+		for _, ref := range rel.References {
+			if !ref.OwnPrimaryKey {
+				continue
+			}
+			if err := tx.Exec("DELETE FROM ? WHERE ? IN ?",
+				clause.Table{Name: rel.JoinTable.Table},
+				clause.Column{Name: ref.ForeignKey.DBName},
+				ids,
+			).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Unscoped().Where(clause.IN{Column: m.column(m.pk), Values: values(ids)}).Delete(m.new()).Error
+}
+
+// child is a relation whose rows go when their parent does.
+type child struct {
+	*model
+	foreignKey *schema.Field
+	// polymorphic type column and value, if any
+	extra []clause.Expression
+}
+
+func (c child) ids(tx *gorm.DB, parentIDs []uint) ([]uint, error) {
+	var ids []uint
+	if len(parentIDs) == 0 || c.pk == nil {
+		return ids, nil
+	}
+	q := tx.Model(c.new()).Where(clause.IN{Column: c.column(c.foreignKey), Values: values(parentIDs)})
+	for _, e := range c.extra {
+		q = q.Where(e)
+	}
+	err := q.Pluck(c.pk.DBName, &ids).Error
+	return ids, err
+}
+
+func (m *model) cascades() []child {
+	var children []child
+	for _, rel := range m.Relationships.Relations {
+		// gorm also lists relations of other schemas pointing here, e.g.
+		// Book.Reviews under BookReview
+		if rel.Schema.ModelType != m.ModelType {
+			continue
+		}
+		if rel.Type != schema.HasOne && rel.Type != schema.HasMany {
+			continue
+		}
+		if !cascadeOnDelete(rel) {
+			continue
+		}
+
+		c := child{model: modelOf(rel.FieldSchema)}
+		for _, ref := range rel.References {
+			switch {
+			case ref.OwnPrimaryKey:
+				c.foreignKey = ref.ForeignKey
+			case ref.PrimaryValue != "":
+				c.extra = append(c.extra, clause.Eq{Column: c.column(ref.ForeignKey), Value: ref.PrimaryValue})
+			}
+		}
+		if c.foreignKey != nil {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// cascadeOnDelete tells whether rel is declared with OnDelete:CASCADE, on
+// the parent's field or on the child's belongs-to back to the parent.
+func cascadeOnDelete(rel *schema.Relationship) bool {
+	if c := rel.ParseConstraint(); c != nil && strings.EqualFold(c.OnDelete, "CASCADE") {
+		return true
+	}
+	for _, back := range rel.FieldSchema.Relationships.Relations {
+		if back.Type != schema.BelongsTo || back.Schema.ModelType != rel.FieldSchema.ModelType || back.FieldSchema.ModelType != rel.Schema.ModelType || len(back.References) != len(rel.References) {
+			continue
+		}
+		if hasOnDeleteCascade(back.Field.TagSettings["CONSTRAINT"]) && sameKeys(rel, back) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOnDeleteCascade(constraint string) bool {
+	for _, part := range strings.Split(constraint, ",") {
+		k, v, _ := strings.Cut(part, ":")
+		if strings.EqualFold(strings.TrimSpace(k), "OnDelete") && strings.EqualFold(strings.TrimSpace(v), "CASCADE") {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKeys(a, b *schema.Relationship) bool {
+	for i := range a.References {
+		if a.References[i].ForeignKey.DBName != b.References[i].ForeignKey.DBName {
+			return false
+		}
+	}
+	return true
+}
+
+func values(ids []uint) []any {
+	vs := make([]any, len(ids))
+	for i, id := range ids {
+		vs[i] = id
+	}
+	return vs
+}
+
+func unique(ids []uint) map[uint]struct{} {
+	set := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
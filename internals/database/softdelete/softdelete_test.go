@@ -0,0 +1,339 @@
+package softdelete_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The models below have the shapes of the real ones: a cascade declared on
+// the parent's field (images, threads), one declared on the child's
+// belongs-to (reviews), a two-level cascade (community, thread, message)
+// and a many-to-many (genres).
+
+type Book struct {
+	ID        uint
+	Title     string
+	DeletedAt gorm.DeletedAt
+	Images    []BookImage  `gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE"`
+	Reviews   []BookReview `gorm:"foreignKey:BookID"`
+	Genres    []Genre      `gorm:"many2many:book_genres"`
+}
+
+type BookImage struct {
+	ID        uint
+	BookID    uint
+	DeletedAt gorm.DeletedAt
+}
+
+type BookReview struct {
+	ID        uint
+	BookID    uint
+	DeletedAt gorm.DeletedAt
+	Book      *Book `gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE"`
+}
+
+type Genre struct {
+	ID    uint
+	Name  string
+	Books []Book `gorm:"many2many:book_genres"`
+}
+
+type Community struct {
+	ID        uint
+	DeletedAt gorm.DeletedAt
+	Threads   []CommunityThread `gorm:"foreignKey:CommunityID;constraint:OnDelete:CASCADE"`
+}
+
+type CommunityThread struct {
+	ID          uint
+	CommunityID uint
+	DeletedAt   gorm.DeletedAt
+	Messages    []CommunityMessage `gorm:"foreignKey:ThreadID;constraint:OnDelete:CASCADE"`
+}
+
+type CommunityMessage struct {
+	ID        uint
+	ThreadID  uint
+	DeletedAt gorm.DeletedAt
+}
+
+// open returns an empty in-memory database whose clock ticks a second at
+// every reading, rows trashed by different calls never share a deleted_at.
+func open(t *testing.T) *gorm.DB {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+		NowFunc: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&Book{}, &BookImage{}, &BookReview{}, &Genre{}, &Community{}, &CommunityThread{}, &CommunityMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func create(t *testing.T, db *gorm.DB, v any) {
+	t.Helper()
+	if err := db.Create(v).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deletedAt returns the deleted_at of the row of model with id, trashed or
+// not.
+func deletedAt(t *testing.T, db *gorm.DB, model any, id uint) gorm.DeletedAt {
+	t.Helper()
+	var at gorm.DeletedAt
+	if err := db.Unscoped().Model(model).Where("id = ?", id).Select("deleted_at").Scan(&at).Error; err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
+
+func TestDefaultScopeHidesTrashed(t *testing.T) {
+	db := open(t)
+	kept := Book{Title: "kept", Images: []BookImage{{}, {}}}
+	trashed := Book{Title: "trashed"}
+	create(t, db, &kept)
+	create(t, db, &trashed)
+	if err := softdelete.Delete[Book](db, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := softdelete.Delete[BookImage](db, kept.Images[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var books []Book
+	if err := db.Preload("Images").Find(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].ID != kept.ID {
+		t.Fatalf("Find returned %+v, want only the book %d", books, kept.ID)
+	}
+	if len(books[0].Images) != 1 || books[0].Images[0].ID != kept.Images[1].ID {
+		t.Errorf("preloaded images %+v, want only the image %d", books[0].Images, kept.Images[1].ID)
+	}
+	if err := db.First(&Book{}, trashed.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("First of a trashed book: %v, want gorm.ErrRecordNotFound", err)
+	}
+	var count int64
+	if err := db.Unscoped().Model(&Book{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Unscoped counts %d books, want 2", count)
+	}
+}
+
+func TestDeleteAndRestoreCascade(t *testing.T) {
+	db := open(t)
+	book := Book{Title: "book", Images: []BookImage{{}, {}}, Reviews: []BookReview{{}}}
+	create(t, db, &book)
+	// trashed on its own before the book, it stays in the trash
+	early := book.Images[1].ID
+	if err := softdelete.Delete[BookImage](db, early); err != nil {
+		t.Fatal(err)
+	}
+	earlyAt := deletedAt(t, db, &BookImage{}, early)
+
+	if err := softdelete.Delete[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	at := deletedAt(t, db, &Book{}, book.ID)
+	if !at.Valid {
+		t.Fatal("the book isn't trashed")
+	}
+	if got := deletedAt(t, db, &BookImage{}, book.Images[0].ID); got != at {
+		t.Errorf("image deleted_at %v, want the book's %v", got, at)
+	}
+	if got := deletedAt(t, db, &BookReview{}, book.Reviews[0].ID); got != at {
+		t.Errorf("review deleted_at %v, want the book's %v", got, at)
+	}
+	if got := deletedAt(t, db, &BookImage{}, early); got != earlyAt {
+		t.Errorf("image trashed earlier has deleted_at %v, want it kept at %v", got, earlyAt)
+	}
+
+	if err := softdelete.Restore[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []struct {
+		model any
+		id    uint
+	}{{&Book{}, book.ID}, {&BookImage{}, book.Images[0].ID}, {&BookReview{}, book.Reviews[0].ID}} {
+		if got := deletedAt(t, db, row.model, row.id); got.Valid {
+			t.Errorf("%T %d still trashed after Restore", row.model, row.id)
+		}
+	}
+	if got := deletedAt(t, db, &BookImage{}, early); got != earlyAt {
+		t.Errorf("image trashed earlier restored with the book")
+	}
+
+	if err := softdelete.Restore[Book](db, book.ID); !errors.As(err, new(*dberrors.ErrNotFound)) {
+		t.Errorf("Restore of a live book: %v, want *dberrors.ErrNotFound", err)
+	}
+}
+
+func TestDeleteAndRestoreCascadeThreads(t *testing.T) {
+	db := open(t)
+	community := Community{Threads: []CommunityThread{
+		{Messages: []CommunityMessage{{}, {}}},
+		{Messages: []CommunityMessage{{}}},
+	}}
+	create(t, db, &community)
+
+	if err := softdelete.Delete[Community](db, community.ID); err != nil {
+		t.Fatal(err)
+	}
+	at := deletedAt(t, db, &Community{}, community.ID)
+	for _, thread := range community.Threads {
+		if got := deletedAt(t, db, &CommunityThread{}, thread.ID); got != at {
+			t.Errorf("thread %d deleted_at %v, want the community's %v", thread.ID, got, at)
+		}
+		for _, msg := range thread.Messages {
+			if got := deletedAt(t, db, &CommunityMessage{}, msg.ID); got != at {
+				t.Errorf("message %d deleted_at %v, want the community's %v", msg.ID, got, at)
+			}
+		}
+	}
+
+	if err := softdelete.Restore[Community](db, community.ID); err != nil {
+		t.Fatal(err)
+	}
+	var threads, messages int64
+	db.Model(&CommunityThread{}).Count(&threads)
+	db.Model(&CommunityMessage{}).Count(&messages)
+	if threads != 2 || messages != 3 {
+		t.Errorf("after Restore %d threads and %d messages are live, want 2 and 3", threads, messages)
+	}
+}
+
+func TestListTrashed(t *testing.T) {
+	db := open(t)
+	books := []Book{{Title: "a"}, {Title: "b"}, {Title: "c"}, {Title: "live"}}
+	create(t, db, &books)
+	// deleted in this order, each at a later time
+	for _, i := range []int{1, 0, 2} {
+		if err := softdelete.Delete[Book](db, books[i].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trashed, err := softdelete.ListTrashed[Book](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, b := range trashed {
+		titles = append(titles, b.Title)
+	}
+	if want := []string{"c", "a", "b"}; !slices.Equal(titles, want) {
+		t.Errorf("ListTrashed returned %v, want %v (most recently deleted first)", titles, want)
+	}
+
+	trashed, err = softdelete.ListTrashed[Book](db.Where("title <> ?", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 2 {
+		t.Errorf("ListTrashed with a condition returned %d books, want 2", len(trashed))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	db := open(t)
+	fiction := Genre{Name: "fiction"}
+	create(t, db, &fiction)
+	book := Book{Title: "book", Images: []BookImage{{}, {}}, Reviews: []BookReview{{}}, Genres: []Genre{fiction}}
+	create(t, db, &book)
+
+	if err := softdelete.Purge[Book](db, book.ID); !errors.As(err, new(*dberrors.ErrNotFound)) {
+		t.Errorf("Purge of a live book: %v, want *dberrors.ErrNotFound", err)
+	}
+	if err := softdelete.Delete[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	// the genre links outlive the trash, Restore has them back
+	if n := links(t, db); n != 1 {
+		t.Fatalf("%d genre links after Delete, want 1", n)
+	}
+	if err := softdelete.Purge[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []any{&Book{}, &BookImage{}, &BookReview{}} {
+		var count int64
+		if err := db.Unscoped().Model(model).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d %T rows left after Purge, want 0", count, model)
+		}
+	}
+	if n := links(t, db); n != 0 {
+		t.Errorf("%d genre links left after Purge, want 0", n)
+	}
+	if err := db.First(&Genre{}, fiction.ID).Error; err != nil {
+		t.Errorf("the genre went with the book: %v", err)
+	}
+}
+
+func TestGenreLinksHiddenWhileTrashed(t *testing.T) {
+	db := open(t)
+	fiction := Genre{Name: "fiction"}
+	create(t, db, &fiction)
+	book := Book{Title: "book", Genres: []Genre{fiction}}
+	create(t, db, &book)
+	if err := softdelete.Delete[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var genre Genre
+	if err := db.Preload("Books").First(&genre, fiction.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(genre.Books) != 0 {
+		t.Errorf("the genre lists the trashed book: %+v", genre.Books)
+	}
+
+	if err := softdelete.Restore[Book](db, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Preload("Books").First(&genre, fiction.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(genre.Books) != 1 {
+		t.Errorf("the restored book lost its genre")
+	}
+}
+
+// links counts the rows of the book_genres join table.
+func links(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table("book_genres").Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
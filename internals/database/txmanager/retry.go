@@ -0,0 +1,164 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Reason says why a transaction failed in a way worth retrying.
+type Reason string
+
+const (
+	ReasonDeadlock             Reason = "deadlock"
+	ReasonLockWaitTimeout      Reason = "lock_wait_timeout"
+	ReasonSerializationFailure Reason = "serialization_failure"
+)
+
+// RetryReason classifies a driver error. It returns false for permanent
+// failures (constraint violations, syntax errors, not found, ...) which
+// would fail the same way again.
+func RetryReason(err error) (Reason, bool) {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1213: // ER_LOCK_DEADLOCK
+			return ReasonDeadlock, true
+		case 1205: // ER_LOCK_WAIT_TIMEOUT
+			return ReasonLockWaitTimeout, true
+		}
+		return "", false
+	}
+
+	// pgx and lib/pq errors both expose the SQLSTATE this way
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		switch pgErr.SQLState() {
+		case "40P01": // deadlock_detected
+			return ReasonDeadlock, true
+		case "40001": // serialization_failure
+			return ReasonSerializationFailure, true
+		case "55P03": // lock_not_available
+			return ReasonLockWaitTimeout, true
+		}
+	}
+	return "", false
+}
+
+// RetryPolicy controls how often and how patiently a unit of work is retried
+// after a retryable failure.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try, 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is doubled after every attempt, up to MaxDelay, and
+	// jittered so that the transactions that deadlocked each other don't
+	// collide again.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used unless the manager or the unit says otherwise.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+
+// WithRetry sets the retry policy of the unit.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) { o.retry = &p }
+}
+
+// NoRetry runs the unit exactly once.
+func NoRetry() Option {
+	return WithRetry(RetryPolicy{MaxAttempts: 1})
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// equal jitter: half of d, plus up to the other half at random, in
+	// [d/2, d]; never much shorter than the backoff it jitters
+	return d/2 + rand.N(d/2+1)
+}
+
+// Stats are the retry counters of a Manager.
+type Stats struct {
+	// Units is the number of outermost units run.
+	Units uint64 `json:"units"`
+	// Retries is the number of extra attempts, by reason.
+	Retries map[Reason]uint64 `json:"retries"`
+	// Exhausted is the number of units that still failed with a retryable
+	// error after their last attempt.
+	Exhausted uint64 `json:"exhausted"`
+}
+
+type counters struct {
+	units, exhausted                  atomic.Uint64
+	deadlock, lockWait, serialization atomic.Uint64
+}
+
+func (c *counters) retried(r Reason) {
+	switch r {
+	case ReasonDeadlock:
+		c.deadlock.Add(1)
+	case ReasonLockWaitTimeout:
+		c.lockWait.Add(1)
+	case ReasonSerializationFailure:
+		c.serialization.Add(1)
+	}
+}
+
+// Stats returns a snapshot of the retry counters.
+func (m *Manager) Stats() Stats {
+	return Stats{
+		Units: m.stats.units.Load(),
+		Retries: map[Reason]uint64{
+			ReasonDeadlock:             m.stats.deadlock.Load(),
+			ReasonLockWaitTimeout:      m.stats.lockWait.Load(),
+			ReasonSerializationFailure: m.stats.serialization.Load(),
+		},
+		Exhausted: m.stats.exhausted.Load(),
+	}
+}
+
+// OnRetry registers a callback invoked before every retry, e.g. to log it.
+func (m *Manager) OnRetry(fn func(attempt int, reason Reason, err error)) {
+	m.onRetry = fn
+}
+
+// withRetry calls attempt until it succeeds, fails permanently or the policy
+// runs out of attempts.
+func (m *Manager) withRetry(ctx context.Context, p RetryPolicy, attempt func() error) error {
+	m.stats.units.Add(1)
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		reason, ok := RetryReason(err)
+		if !ok {
+			return err
+		}
+		if n >= p.MaxAttempts {
+			m.stats.exhausted.Add(1)
+			return err
+		}
+
+		m.stats.retried(reason)
+		if m.onRetry != nil {
+			m.onRetry(n, reason, err)
+		}
+
+		t := time.NewTimer(p.delay(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
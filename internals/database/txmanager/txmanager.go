@@ -0,0 +1,179 @@
+// Package txmanager runs units of work in a transaction that travels in the
+// context.
+//
+// Repositories get their *gorm.DB from Manager.DB(ctx) instead of holding on
+// to one, so a repository called inside Do joins the caller's transaction
+// without being told about it:
+//
+//	err := tm.Do(ctx, func(ctx context.Context) error {
+//		if err := subscriptions.Create(ctx, &sub); err != nil { // tm.DB(ctx) inside
+//			return err
+//		}
+//		txmanager.AfterCommit(ctx, func(ctx context.Context) {
+//			notify(sub.UserID) // only once the subscription is really there
+//		})
+//		return payments.Create(ctx, &pmt)
+//	})
+//
+// A Do inside a Do is a nested unit backed by a savepoint: if it fails only
+// its own work is rolled back and the caller decides what to do with the
+// error.
+//
+// An outermost unit that fails on a deadlock, lock wait timeout or
+// serialization failure is rolled back and run again from the start (see
+// RetryPolicy), so fn must not have side effects outside the database other
+// than through AfterCommit.
+package txmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrIsolationMismatch is returned when a nested unit asks for an isolation
+// level other than the one of the transaction it would join.
+var ErrIsolationMismatch = errors.New("txmanager: nested unit can't change the isolation level")
+
+type ctxKey struct{}
+
+// unit is one (possibly nested) unit of work.
+type unit struct {
+	tx          *gorm.DB
+	isolation   sql.IsolationLevel
+	afterCommit []func(context.Context)
+}
+
+type options struct {
+	isolation sql.IsolationLevel
+	readOnly  bool
+	retry     *RetryPolicy
+}
+
+// Option configures a unit of work.
+type Option func(*options)
+
+// WithIsolation sets the isolation level of the transaction.
+func WithIsolation(level sql.IsolationLevel) Option {
+	return func(o *options) { o.isolation = level }
+}
+
+// ReadOnly starts a read-only transaction.
+func ReadOnly() Option {
+	return func(o *options) { o.readOnly = true }
+}
+
+// Manager starts units of work on a database.
+type Manager struct {
+	db       *gorm.DB
+	defaults []Option
+	stats    counters
+	onRetry  func(attempt int, reason Reason, err error)
+}
+
+// New returns a Manager for db. The options apply to every outermost unit
+// unless overridden in Do.
+func New(db *gorm.DB, defaults ...Option) *Manager {
+	return &Manager{db: db, defaults: defaults}
+}
+
+// DB returns the transaction carried by ctx, or the plain database when
+// there is none, bound to ctx either way.
+func (m *Manager) DB(ctx context.Context) *gorm.DB {
+	if tx, ok := FromContext(ctx); ok {
+		return tx.WithContext(ctx)
+	}
+	return m.db.WithContext(ctx)
+}
+
+// FromContext returns the transaction carried by ctx.
+func FromContext(ctx context.Context) (*gorm.DB, bool) {
+	u, ok := ctx.Value(ctxKey{}).(*unit)
+	if !ok {
+		return nil, false
+	}
+	return u.tx, true
+}
+
+// Do runs fn in a unit of work. Returning an error (or panicking) rolls the
+// unit back, otherwise it is committed; when ctx already carries a
+// transaction fn runs in a savepoint of it, and is never retried on its own.
+// After-commit hooks only run once the outermost transaction has committed.
+func (m *Manager) Do(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) error {
+	if parent, ok := ctx.Value(ctxKey{}).(*unit); ok {
+		return m.nested(ctx, parent, fn, opts)
+	}
+
+	var o options
+	for _, opt := range m.defaults {
+		opt(&o)
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	policy := DefaultRetryPolicy
+	if o.retry != nil {
+		policy = *o.retry
+	}
+
+	var u *unit
+	err := m.withRetry(ctx, policy, func() error {
+		// every attempt starts from scratch, hooks of a failed one included
+		u = &unit{isolation: o.isolation}
+		return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			u.tx = tx
+			return fn(context.WithValue(ctx, ctxKey{}, u))
+		}, &sql.TxOptions{Isolation: o.isolation, ReadOnly: o.readOnly})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range u.afterCommit {
+		hook(ctx)
+	}
+	return nil
+}
+
+func (m *Manager) nested(ctx context.Context, parent *unit, fn func(ctx context.Context) error, opts []Option) error {
+	// the manager defaults were already applied to the outermost unit, only
+	// what this call asks for explicitly is checked
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.isolation != sql.LevelDefault && o.isolation != parent.isolation {
+		return ErrIsolationMismatch
+	}
+
+	u := &unit{isolation: parent.isolation}
+	// Transaction on a *gorm.DB that is already a transaction uses
+	// SAVEPOINT / ROLLBACK TO SAVEPOINT
+	err := parent.tx.Transaction(func(tx *gorm.DB) error {
+		u.tx = tx
+		return fn(context.WithValue(ctx, ctxKey{}, u))
+	})
+	if err != nil {
+		// the hooks belonged to work that was rolled back
+		return err
+	}
+
+	parent.afterCommit = append(parent.afterCommit, u.afterCommit...)
+	return nil
+}
+
+// AfterCommit registers fn to run after the transaction carried by ctx
+// commits; it is dropped if the transaction (or the nested unit registering
+// it) rolls back. Outside a unit of work fn runs right away. fn receives the
+// context Do was called with, which no longer carries the transaction.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	u, ok := ctx.Value(ctxKey{}).(*unit)
+	if !ok {
+		fn(ctx)
+		return
+	}
+	u.afterCommit = append(u.afterCommit, fn)
+}
@@ -0,0 +1,144 @@
+// Package events carries live events to the users they are about: new
+// notifications and exchange status changes, streamed to clients by the
+// /me/events endpoint.
+//
+// Plugin publishes an event once the transaction writing the row commits,
+// whoever writes it. A Broker carries the published events to every
+// instance of the application, where the Hub hands them to the streams of
+// their user:
+//
+//	broker, err := events.New(ctx, config, db)
+//	db.Use(&events.Plugin{Broker: broker})
+//	hub := events.NewHub(broker)
+//	go hub.Run(ctx)
+//
+//	sub := hub.Subscribe(userID)
+//	defer sub.Close()
+//	for e := range sub.C { ... } // closed when the stream falls behind
+//
+// Chat events (messages, typing, delivery) go to the chat sockets of their
+// thread, not to /me/events. The poll backend doesn't carry them, there is
+// no chat with it (see Hub.CarriesPublished).
+//
+// Only notification events can be replayed: their ID is the notification's,
+// a client that lost its stream asks for the notifications after the last
+// one it saw, and gets again those created within Overlap before it. IDs
+// are taken on insert and committed out of order, they are no high-water
+// mark. Exchange events are current state, a client catching up reads the
+// exchange.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Event types.
+const (
+	TypeNotification = "notification"
+	TypeExchange     = "exchange"
+	// chat events, for the chat sockets of the thread only
+	TypeMessage   = "message"
+	TypeTyping    = "typing"
+	TypeDelivered = "delivered"
+)
+
+// Event is something UserID should hear about.
+type Event struct {
+	UserID uint `json:"user_id"`
+	// ID is the notification ID of notification events and the message ID
+	// of message events, 0 for events that can't be replayed.
+	ID uint `json:"id,omitempty"`
+	// ThreadID is the chat thread of chat events.
+	ThreadID uint            `json:"thread_id,omitempty"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Broker carries events between the instances of the application.
+type Broker interface {
+	// Publish sends e to every instance, this one included.
+	Publish(ctx context.Context, e Event) error
+	// Run calls deliver with the events published by any instance until ctx
+	// is done.
+	Run(ctx context.Context, deliver func(Event)) error
+}
+
+// New returns the Broker configured by cfg, db being the database the poll
+// backend reads.
+func New(ctx context.Context, cfg *config.Container, db *gorm.DB) (Broker, error) {
+	switch cfg.Events.Backend {
+	case "local":
+		return &Local{}, nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     net.JoinHostPort(cfg.Redis.Host, cfg.Redis.Port),
+			Password: cfg.Redis.Password,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("events: connecting to redis: %w", err)
+		}
+		return NewRedis(client, "gormpg:events"), nil
+	case "poll":
+		return NewPoller(db, cfg.Events.PollInterval), nil
+	}
+	return nil, fmt.Errorf("events: unknown backend %q", cfg.Events.Backend)
+}
+
+// NotificationEvent is the event of a new notification, its data the
+// notification itself.
+func NotificationEvent(n *models.Notification) (Event, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{UserID: n.UserID, ID: n.ID, Type: TypeNotification, Data: data}, nil
+}
+
+// exchangeData is the data of an exchange event.
+type exchangeData struct {
+	ExchangeID      uint       `json:"exchange_id"`
+	Status          string     `json:"status"`
+	Version         uint       `json:"version"`
+	StatusUpdatedAt *time.Time `json:"status_updated_at"`
+}
+
+// ExchangeEvents are the events of a change of ex, one for each participant.
+func ExchangeEvents(ex *models.Exchange) ([]Event, error) {
+	data, err := json.Marshal(exchangeData{
+		ExchangeID:      ex.ID,
+		Status:          ex.Status,
+		Version:         uint(ex.Version),
+		StatusUpdatedAt: ex.StatusUpdatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{{UserID: ex.RequesterID, Type: TypeExchange, Data: data}}
+	if ex.ResponderID != nil {
+		events = append(events, Event{UserID: *ex.ResponderID, Type: TypeExchange, Data: data})
+	}
+	return events, nil
+}
+
+// ChatEvents are the chat events of threadID with data for each of userIDs,
+// id being the message ID of message events.
+func ChatEvents(typ string, threadID, id uint, data any, userIDs ...uint) ([]Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(userIDs))
+	for i, userID := range userIDs {
+		events[i] = Event{UserID: userID, ID: id, ThreadID: threadID, Type: typ, Data: raw}
+	}
+	return events, nil
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriptionBuffer is how many events a stream may fall behind by before
+// it is dropped.
+const subscriptionBuffer = 64
+
+// Hub hands the events of its Broker to the subscriptions of this instance.
+type Hub struct {
+	broker Broker
+
+	mu   sync.Mutex
+	subs map[uint]map[*Subscription]struct{}
+}
+
+// NewHub returns a Hub for the events of broker, they only flow once Run
+// is running.
+func NewHub(broker Broker) *Hub {
+	return &Hub{broker: broker, subs: map[uint]map[*Subscription]struct{}{}}
+}
+
+// Run delivers the events of the broker until ctx is done.
+func (h *Hub) Run(ctx context.Context) error {
+	return h.broker.Run(ctx, h.deliver)
+}
+
+// Publish publishes e on the broker.
+func (h *Hub) Publish(ctx context.Context, e Event) error {
+	return h.broker.Publish(ctx, e)
+}
+
+// CarriesPublished tells whether the events published on the hub reach
+// subscribers. The poll backend only delivers what it finds in the
+// database, chat events (typing, delivery) aren't there.
+func (h *Hub) CarriesPublished() bool {
+	_, poll := h.broker.(*Poller)
+	return !poll
+}
+
+// Subscription receives the events of a user on C.
+type Subscription struct {
+	// C is closed by Close, and when the subscriber fell too far behind;
+	// the client has to resume from the last event it got.
+	C <-chan Event
+
+	c      chan Event
+	hub    *Hub
+	userID uint
+}
+
+// Subscribe subscribes to the events of userID.
+func (h *Hub) Subscribe(userID uint) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, hub: h, userID: userID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][s] = struct{}{}
+	return s
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Subscribers returns how many subscriptions the hub has.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+func (h *Hub) deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[e.UserID] {
+		select {
+		case s.c <- e:
+		default:
+			// a stream this far behind is better off resuming
+			h.remove(s)
+		}
+	}
+}
+
+// remove drops s and closes its channel, h.mu held.
+func (h *Hub) remove(s *Subscription) {
+	subs := h.subs[s.userID]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.subs, s.userID)
+	}
+	close(s.c)
+}
@@ -0,0 +1,36 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is the Broker of a single instance: events published go straight to
+// its own Run.
+type Local struct {
+	mu      sync.RWMutex
+	deliver func(Event)
+}
+
+// Publish delivers e, it is dropped when Run isn't running.
+func (l *Local) Publish(_ context.Context, e Event) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.deliver != nil {
+		l.deliver(e)
+	}
+	return nil
+}
+
+func (l *Local) Run(ctx context.Context, deliver func(Event)) error {
+	l.mu.Lock()
+	l.deliver = deliver
+	l.mu.Unlock()
+
+	<-ctx.Done()
+
+	l.mu.Lock()
+	l.deliver = nil
+	l.mu.Unlock()
+	return nil
+}
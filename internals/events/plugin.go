@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+)
+
+// Plugin publishes the events of the notifications created and the exchanges
+// updated through gorm on Broker, once their transaction commits:
+//
+//	db.Use(&events.Plugin{Broker: broker})
+//
+// Exchanges are only seen when the statement updates a loaded model (Save,
+// Model(&ex).Updates), an update by condition alone doesn't say which rows it
+// changed.
+type Plugin struct {
+	Broker Broker
+}
+
+func (*Plugin) Name() string { return "events" }
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("events:after_create", p.afterCreate); err != nil {
+		return err
+	}
+	return cb.Update().After("gorm:update").Register("events:after_update", p.afterUpdate)
+}
+
+func (p *Plugin) afterCreate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 {
+		return
+	}
+	var events []Event
+	for _, n := range rows[models.Notification](db.Statement.ReflectValue) {
+		e, err := NotificationEvent(n)
+		if err != nil {
+			slog.Warn("events: encoding notification", "id", n.ID, "error", err)
+			continue
+		}
+		events = append(events, e)
+	}
+	p.publish(db.Statement.Context, events)
+}
+
+func (p *Plugin) afterUpdate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 {
+		return
+	}
+	var events []Event
+	for _, ex := range rows[models.Exchange](db.Statement.ReflectValue) {
+		if ex.ID == 0 {
+			continue
+		}
+		evs, err := ExchangeEvents(ex)
+		if err != nil {
+			slog.Warn("events: encoding exchange", "id", ex.ID, "error", err)
+			continue
+		}
+		events = append(events, evs...)
+	}
+	p.publish(db.Statement.Context, events)
+}
+
+// publish publishes events after the transaction of ctx commits, right away
+// when there is none.
+func (p *Plugin) publish(ctx context.Context, events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	txmanager.AfterCommit(ctx, func(ctx context.Context) {
+		// the request may be over by the time its transaction commits
+		ctx = context.WithoutCancel(ctx)
+		for _, e := range events {
+			if err := p.Broker.Publish(ctx, e); err != nil {
+				slog.Warn("events: publishing", "type", e.Type, "user_id", e.UserID, "error", err)
+			}
+		}
+	})
+}
+
+// rows returns the T a statement's value holds, be it a T or a slice of them.
+func rows[T any](v reflect.Value) []*T {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	typ := reflect.TypeFor[T]()
+	switch {
+	case v.Type() == typ && v.CanAddr():
+		return []*T{v.Addr().Interface().(*T)}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		var out []*T
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Type() == typ && elem.CanAddr() {
+				out = append(out, elem.Addr().Interface().(*T))
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"gorm.io/gorm"
+)
+
+// Overlap is how long a transaction may take to commit after stamping its
+// rows: rows are stamped (their id and timestamps taken) on insert, not on
+// commit, and may become visible out of order. Each poll reaches this far
+// behind the previous one, as does the replay of a resumed event stream.
+const Overlap = 5 * time.Second
+
+// Poller is the Broker of instances sharing nothing but the database: rather
+// than being published, events are found by polling the tables for new
+// notifications and changed exchanges. Events are as late as the interval.
+// Published events, the chat's, go nowhere.
+type Poller struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+// NewPoller returns a Broker polling db every interval.
+func NewPoller(db *gorm.DB, interval time.Duration) *Poller {
+	return &Poller{db: db, interval: interval}
+}
+
+// Publish does nothing, Run finds the rows behind the event itself.
+func (p *Poller) Publish(context.Context, Event) error { return nil }
+
+func (p *Poller) Run(ctx context.Context, deliver func(Event)) error {
+	db := p.db.WithContext(ctx)
+	// only what happens from now on
+	notificationsSince, exchangesSince := time.Now(), time.Now()
+	// notifications delivered within the overlap
+	seenNotifications := map[uint]time.Time{}
+	// versions of the exchanges delivered within the overlap
+	seenExchanges := map[uint]seenVersion{}
+	// the rows within the overlap before now were there before the
+	// subscribers of this instance, they are seen without being delivered;
+	// should that fail they are delivered once more
+	skip := func(Event) {}
+	var err error
+	if notificationsSince, err = p.notifications(db, notificationsSince, seenNotifications, skip); err != nil && ctx.Err() == nil {
+		slog.Warn("events: polling notifications", "error", err)
+	}
+	if exchangesSince, err = p.exchanges(db, exchangesSince, seenExchanges, skip); err != nil && ctx.Err() == nil {
+		slog.Warn("events: polling exchanges", "error", err)
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if notificationsSince, err = p.notifications(db, notificationsSince, seenNotifications, deliver); err != nil && ctx.Err() == nil {
+			slog.Warn("events: polling notifications", "error", err)
+		}
+		if exchangesSince, err = p.exchanges(db, exchangesSince, seenExchanges, deliver); err != nil && ctx.Err() == nil {
+			slog.Warn("events: polling exchanges", "error", err)
+		}
+	}
+}
+
+type seenVersion struct {
+	version uint
+	at      time.Time
+}
+
+// notifications delivers the notifications created since, less Overlap,
+// and returns the new since. Their ids can't be the cursor: a notification
+// with a lower id may commit after one with a higher id was delivered.
+func (p *Poller) notifications(db *gorm.DB, since time.Time, seen map[uint]time.Time, deliver func(Event)) (time.Time, error) {
+	var rows []models.Notification
+	if err := db.Where("created_at > ?", since.Add(-Overlap)).Order("created_at, id").Find(&rows).Error; err != nil {
+		return since, err
+	}
+	for i := range rows {
+		n := &rows[i]
+		if _, ok := seen[n.ID]; ok {
+			continue
+		}
+		e, err := NotificationEvent(n)
+		if err != nil {
+			return since, err
+		}
+		deliver(e)
+		seen[n.ID] = *n.CreatedAt
+		if n.CreatedAt.After(since) {
+			since = *n.CreatedAt
+		}
+	}
+	for id, at := range seen {
+		if at.Before(since.Add(-Overlap)) {
+			delete(seen, id)
+		}
+	}
+	return since, nil
+}
+
+// exchanges delivers the exchanges changed since, less Overlap, and
+// returns the new since.
+func (p *Poller) exchanges(db *gorm.DB, since time.Time, seen map[uint]seenVersion, deliver func(Event)) (time.Time, error) {
+	var rows []models.Exchange
+	if err := db.Select("id", "requester_id", "responder_id", "status", "status_updated_at", "version").
+		Where("status_updated_at > ?", since.Add(-Overlap)).
+		Order("status_updated_at").
+		Find(&rows).Error; err != nil {
+		return since, err
+	}
+	for i := range rows {
+		ex := &rows[i]
+		version := uint(ex.Version)
+		if s, ok := seen[ex.ID]; ok && s.version >= version {
+			continue
+		}
+		events, err := ExchangeEvents(ex)
+		if err != nil {
+			return since, err
+		}
+		for _, e := range events {
+			deliver(e)
+		}
+		seen[ex.ID] = seenVersion{version: version, at: *ex.StatusUpdatedAt}
+		if ex.StatusUpdatedAt.After(since) {
+			since = *ex.StatusUpdatedAt
+		}
+	}
+	for id, s := range seen {
+		if s.at.Before(since.Add(-Overlap)) {
+			delete(seen, id)
+		}
+	}
+	return since, nil
+}
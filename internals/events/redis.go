@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is the Broker of several instances sharing a Redis: events are
+// published on a pub/sub channel every instance subscribes to. Pub/sub
+// doesn't keep messages, an instance only gets what is published while it
+// is subscribed.
+type Redis struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedis returns a Broker publishing on channel of client.
+func NewRedis(client *redis.Client, channel string) *Redis {
+	return &Redis{client: client, channel: channel}
+}
+
+func (r *Redis) Publish(ctx context.Context, e Event) error {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, msg).Err()
+}
+
+func (r *Redis) Run(ctx context.Context, deliver func(Event)) error {
+	sub := r.client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+	// wait for the subscription, so a failing Redis is an error of Run
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	// the channel reconnects on its own when the connection drops
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				slog.Warn("events: dropping malformed message", "channel", r.channel, "error", err)
+				continue
+			}
+			deliver(e)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
+	"github.com/labstack/echo/v4"
+)
+
+type accountHandler struct {
+	sessions *auth.Service
+}
+
+type registerInput struct {
+	Email       string `json:"email"`
+	Phone       string `json:"phone"`
+	Password    string `json:"password"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DisplayName string `json:"display_name"`
+}
+
+// register serves POST /auth/register: the user and its profile are
+// created, the client logs in next.
+func (h *accountHandler) register(c echo.Context) error {
+	var in registerInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.FirstName = strings.TrimSpace(in.FirstName)
+	in.LastName = strings.TrimSpace(in.LastName)
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	email := auth.NormalizeEmail(in.Email)
+	phone := auth.NormalizePhone(in.Phone)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email || len(email) > 255 {
+		return invalid("email", "is not a valid email address")
+	}
+	switch {
+	case len(phone) < 7 || len(phone) > 15:
+		return invalid("phone", "must have 7 to 15 digits")
+	case len(in.Password) < 8:
+		return invalid("password", "is shorter than 8 characters")
+	case len(in.Password) > 256:
+		return invalid("password", "is longer than 256 characters")
+	case in.FirstName == "":
+		return invalid("first_name", "is required")
+	case len(in.FirstName) > 100:
+		return invalid("first_name", "is longer than 100 characters")
+	case len(in.LastName) > 100:
+		return invalid("last_name", "is longer than 100 characters")
+	case len(in.DisplayName) > 25:
+		return invalid("display_name", "is longer than 25 characters")
+	}
+
+	user, err := h.sessions.Register(c.Request().Context(), auth.Registration{
+		Email:       email,
+		Phone:       phone,
+		Password:    in.Password,
+		FirstName:   in.FirstName,
+		LastName:    in.LastName,
+		DisplayName: in.DisplayName,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, user)
+}
+
+type loginInput struct {
+	// Login is the email or the phone.
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// login serves POST /auth/login: an access token for the email or phone and
+// password, a 401 for a wrong one.
+func (h *accountHandler) login(c echo.Context) error {
+	var in loginInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	switch {
+	case strings.TrimSpace(in.Login) == "":
+		return invalid("login", "is required")
+	case in.Password == "":
+		return invalid("password", "is required")
+	}
+	session, err := h.sessions.Login(c.Request().Context(), auth.Credentials{Login: in.Login, Password: in.Password}, client(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// logout serves POST /auth/logout: the session of the access token ends.
+func (h *accountHandler) logout(c echo.Context) error {
+	if err := h.sessions.Logout(c.Request().Context(), auth.BearerToken(c.Request()), client(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// client is who sent the request, for the activity log.
+func client(c echo.Context) auth.Client {
+	return auth.Client{
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
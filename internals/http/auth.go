@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrUnauthenticated is returned by an Authenticator for a request that
+// carries no valid credentials.
+var ErrUnauthenticated = auth.ErrUnauthenticated
+
+// Authenticator tells who sent a request.
+type Authenticator interface {
+	// Authenticate returns the user r was sent by, or ErrUnauthenticated.
+	Authenticate(r *http.Request) (*models.User, error)
+}
+
+// userKey holds the authenticated user in the echo context.
+const userKey = "auth:user"
+
+// requireUser rejects requests that aren't sent by an active user. Without
+// an Authenticator every request is rejected.
+func requireUser(auth Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if auth == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthenticated.Error())
+			}
+			user, err := auth.Authenticate(c.Request())
+			if errors.Is(err, ErrUnauthenticated) {
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			}
+			if err != nil {
+				return err
+			}
+			if !user.IsActive {
+				return echo.NewHTTPError(http.StatusForbidden, "account is deactivated")
+			}
+			c.Set(userKey, user)
+			return next(c)
+		}
+	}
+}
+
+// requireRole rejects requests from users without one of roles, it goes
+// after requireUser.
+func requireRole(roles ...models.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := currentUser(c); user == nil || !slices.Contains(roles, user.Role) {
+				return echo.NewHTTPError(http.StatusForbidden, "not allowed")
+			}
+			return next(c)
+		}
+	}
+}
+
+// currentUser returns the user set by requireUser.
+func currentUser(c echo.Context) *models.User {
+	user, _ := c.Get(userKey).(*models.User)
+	return user
+}
@@ -0,0 +1,371 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/optlock"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type bookHandler struct {
+	books *repository.BookRepository
+}
+
+// bookInput is the body of POST /books and PATCH /books/:id, fields left
+// out are left as they are.
+type bookInput struct {
+	Title           *string           `json:"title"`
+	Subtitle        *string           `json:"subtitle"`
+	AuthorID        *uint             `json:"author_id"`
+	ISBN            *string           `json:"isbn"`
+	Description     *string           `json:"description"`
+	Language        *string           `json:"language"`
+	Condition       *models.Condition `json:"condition"`
+	AvailableFrom   *time.Time        `json:"available_from"`
+	AvailableUntil  *time.Time        `json:"available_until"`
+	LocationCity    *string           `json:"location_city"`
+	LocationState   *string           `json:"location_state"`
+	LocationCountry *string           `json:"location_country"`
+	Latitude        *float64          `json:"latitude"`
+	Longitude       *float64          `json:"longitude"`
+	Active          *bool             `json:"active"`
+	// GenreIDs replaces the genres of the book when present.
+	GenreIDs []uint `json:"genre_ids"`
+	// Version, on update, is the version the client last saw; the update
+	// is a 409 if the book changed since.
+	Version *optlock.Version `json:"version"`
+}
+
+// apply copies the fields present in in onto b and validates the result.
+func (in *bookInput) apply(b *models.Book) error {
+	set(&b.Title, in.Title)
+	set(&b.Description, in.Description)
+	set(&b.Language, in.Language)
+	set(&b.Condition, in.Condition)
+	set(&b.Active, in.Active)
+	setPtr(&b.Subtitle, in.Subtitle)
+	setPtr(&b.AuthorID, in.AuthorID)
+	setPtr(&b.ISBN, in.ISBN)
+	setPtr(&b.AvailableFrom, in.AvailableFrom)
+	setPtr(&b.AvailableUntil, in.AvailableUntil)
+	setPtr(&b.LocationCity, in.LocationCity)
+	setPtr(&b.LocationState, in.LocationState)
+	setPtr(&b.LocationCountry, in.LocationCountry)
+	setPtr(&b.Latitude, in.Latitude)
+	setPtr(&b.Longitude, in.Longitude)
+
+	b.Title = strings.TrimSpace(b.Title)
+	switch {
+	case b.Title == "":
+		return invalid("title", "is required")
+	case len(b.Title) > 1000:
+		return invalid("title", "is longer than 1000 characters")
+	case len(b.Language) > 8:
+		return invalid("language", "is longer than 8 characters")
+	case !b.Condition.IsValid():
+		return invalid("condition", "must be one of new, like_new, good, acceptable")
+	case b.AvailableFrom != nil && b.AvailableUntil != nil && b.AvailableUntil.Before(*b.AvailableFrom):
+		return invalid("available_until", "is before available_from")
+	case b.Latitude != nil && (*b.Latitude < -90 || *b.Latitude > 90):
+		return invalid("latitude", "must be between -90 and 90")
+	case b.Longitude != nil && (*b.Longitude < -180 || *b.Longitude > 180):
+		return invalid("longitude", "must be between -180 and 180")
+	}
+	return nil
+}
+
+func set[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setPtr[T any](dst **T, v *T) {
+	if v != nil {
+		*dst = v
+	}
+}
+
+// list serves GET /books, see BookRepository.List for the filters.
+func (h *bookHandler) list(c echo.Context) error {
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.books.List(c.Request().Context(), c.QueryParams(), req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// get serves GET /books/:id.
+func (h *bookHandler) get(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	book, err := h.books.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, book)
+}
+
+// create serves POST /books, the book belongs to the caller.
+func (h *bookHandler) create(c echo.Context) error {
+	var in bookInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	book := models.Book{
+		OwnerID:   currentUser(c).ID,
+		Language:  "EN",
+		Condition: models.ConditionGood,
+		Active:    true,
+	}
+	if err := in.apply(&book); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	if err := h.books.Create(ctx, &book, in.GenreIDs); err != nil {
+		return err
+	}
+	created, err := h.books.Get(ctx, book.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+// update serves PATCH /books/:id, owner only.
+func (h *bookHandler) update(c echo.Context) error {
+	book, err := h.owned(c)
+	if err != nil {
+		return err
+	}
+	var in bookInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	if in.Version != nil && *in.Version != book.Version {
+		return &dberrors.ErrConflict{Entity: "Book", ID: book.ID, Version: uint(*in.Version)}
+	}
+	if err := in.apply(book); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	if err := h.books.Update(ctx, book, in.GenreIDs); err != nil {
+		return err
+	}
+	updated, err := h.books.Get(ctx, book.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// delete serves DELETE /books/:id, owner only. The book goes to the trash
+// with its images and reviews.
+func (h *bookHandler) delete(c echo.Context) error {
+	book, err := h.owned(c)
+	if err != nil {
+		return err
+	}
+	if err := h.books.Delete(c.Request().Context(), book.ID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// owned returns the book of the :id path parameter, a 403 unless the caller
+// owns it.
+func (h *bookHandler) owned(c echo.Context) (*models.Book, error) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return nil, err
+	}
+	book, err := h.books.Get(c.Request().Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if book.OwnerID != currentUser(c).ID {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "only the owner can change this book")
+	}
+	return book, nil
+}
+
+// images serves GET /books/:id/images.
+func (h *bookHandler) images(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	// a 404 for a missing book, not an empty list
+	if _, err := h.books.Get(ctx, id); err != nil {
+		return err
+	}
+	images, err := h.books.Images(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, images)
+}
+
+type imageInput struct {
+	URL       string `json:"url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	IsPrimary bool   `json:"is_primary"`
+}
+
+// addImage serves POST /books/:id/images, owner only.
+func (h *bookHandler) addImage(c echo.Context) error {
+	book, err := h.owned(c)
+	if err != nil {
+		return err
+	}
+	var in imageInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	switch {
+	case !strings.HasPrefix(in.URL, "https://") && !strings.HasPrefix(in.URL, "http://"):
+		return invalid("url", "must be an http(s) URL")
+	case in.Width < 0:
+		return invalid("width", "can't be negative")
+	case in.Height < 0:
+		return invalid("height", "can't be negative")
+	}
+
+	image := models.BookImage{
+		BookID:     book.ID,
+		URL:        in.URL,
+		Width:      in.Width,
+		Height:     in.Height,
+		IsPrimary:  in.IsPrimary,
+		UploadedAt: time.Now(),
+	}
+	if err := h.books.AddImage(c.Request().Context(), &image); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, image)
+}
+
+// deleteImage serves DELETE /books/:id/images/:image_id, owner only.
+func (h *bookHandler) deleteImage(c echo.Context) error {
+	book, err := h.owned(c)
+	if err != nil {
+		return err
+	}
+	imageID, err := pathID(c, "image_id")
+	if err != nil {
+		return err
+	}
+	if err := h.books.DeleteImage(c.Request().Context(), book.ID, imageID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// reviews serves GET /books/:id/reviews, newest first.
+func (h *bookHandler) reviews(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	if _, err := h.books.Get(ctx, id); err != nil {
+		return err
+	}
+	page, err := h.books.Reviews(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+type reviewInput struct {
+	Rating  uint   `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+// addReview serves POST /books/:id/reviews. Owners can't review their own
+// books and everyone else reviews a book once.
+func (h *bookHandler) addReview(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	var in reviewInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	if in.Rating < 1 || in.Rating > 5 {
+		return invalid("rating", "must be between 1 and 5")
+	}
+
+	ctx := c.Request().Context()
+	user := currentUser(c)
+	book, err := h.books.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if book.OwnerID == user.ID {
+		return echo.NewHTTPError(http.StatusForbidden, "you can't review your own book")
+	}
+	reviewed, err := h.books.Reviewed(ctx, book.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if reviewed {
+		return echo.NewHTTPError(http.StatusConflict, "you already reviewed this book")
+	}
+
+	review := models.BookReview{
+		BookID:     book.ID,
+		ReviewerID: user.ID,
+		Rating:     in.Rating,
+		Comment:    strings.TrimSpace(in.Comment),
+	}
+	if err := h.books.AddReview(ctx, &review); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, review)
+}
+
+// deleteReview serves DELETE /books/:id/reviews/:review_id, reviewer only.
+func (h *bookHandler) deleteReview(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	reviewID, err := pathID(c, "review_id")
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	review, err := h.books.GetReview(ctx, id, reviewID)
+	if err != nil {
+		return err
+	}
+	if review.ReviewerID != currentUser(c).ID {
+		return echo.NewHTTPError(http.StatusForbidden, "only the reviewer can delete this review")
+	}
+	if err := h.books.DeleteReview(ctx, review); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,416 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/events"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// The chat of an exchange is a WebSocket at /exchanges/:id/chat, frames are
+// JSON objects told apart by their type. The client sends:
+//
+//	{"type": "message", "client_id": "c1", "message_type": "text", "body": "Hi!"}
+//	{"type": "typing", "typing": true}
+//	{"type": "delivered", "message_id": 42}  // got every message up to 42
+//
+// and gets:
+//
+//	{"type": "message", "message": {...}}  // a new message, its own included
+//	{"type": "ack", "client_id": "c1", "message": {...}}  // its message is stored
+//	{"type": "typing", "user_id": 7, "typing": true}
+//	{"type": "delivered", "user_id": 7, "message_id": 42, "delivered_at": "..."}
+//	{"type": "synced"}  // the back-fill is over
+//	{"type": "error", "client_id": "c1", "error": "..."}
+//
+// A client connecting with ?after=<id> first gets the messages after that
+// one, it reconnects with the last message id it saw; ?after=0 gets the
+// whole thread. A message sent again with the same client_id (its ack was
+// lost) is only stored once.
+const (
+	// chatWriteWait is how long a frame may take to be written.
+	chatWriteWait = 10 * time.Second
+	// chatPongWait is how long the connection may stay silent, pings are sent
+	// often enough to be answered in time.
+	chatPongWait   = 60 * time.Second
+	chatPingPeriod = chatPongWait * 9 / 10
+	// chatMaxFrame is the size of the largest frame a client may send.
+	chatMaxFrame = 16 << 10
+	// chatOutbox is how many frames for one connection may be waiting.
+	chatOutbox = 16
+	// chatMaxBody and chatMaxAttachments bound a message.
+	chatMaxBody        = 10000
+	chatMaxAttachments = 10
+)
+
+// chatFrame is a frame of the chat, sent or received.
+type chatFrame struct {
+	Type        string             `json:"type"`
+	ClientID    string             `json:"client_id,omitempty"`
+	MessageType models.MessageType `json:"message_type,omitempty"`
+	Body        string             `json:"body,omitempty"`
+	Attachments []string           `json:"attachments,omitempty"`
+	Message     *models.Message    `json:"message,omitempty"`
+	UserID      uint               `json:"user_id,omitempty"`
+	Typing      *bool              `json:"typing,omitempty"`
+	MessageID   uint               `json:"message_id,omitempty"`
+	DeliveredAt *time.Time         `json:"delivered_at,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+type chatHandler struct {
+	chat     *repository.ChatRepository
+	hub      *events.Hub
+	upgrader websocket.Upgrader
+}
+
+func newChatHandler(chat *repository.ChatRepository, hub *events.Hub, allowOrigins []string) *chatHandler {
+	return &chatHandler{
+		chat: chat,
+		hub:  hub,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4 << 10,
+			WriteBufferSize: 4 << 10,
+			CheckOrigin:     checkOrigin(allowOrigins),
+		},
+	}
+}
+
+// checkOrigin lets in the WebSockets of the origins CORS allows, and of the
+// API's own origin.
+func checkOrigin(allowOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || slices.Contains(allowOrigins, "*") || slices.Contains(allowOrigins, origin) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// connect serves GET /exchanges/:id/chat, participants only: the upgrade to
+// the chat's WebSocket, see chatFrame.
+func (h *chatHandler) connect(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	// nil without ?after, no back-fill
+	var after *uint
+	if raw := c.QueryParam("after"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "after must be a non-negative integer")
+		}
+		from := uint(n)
+		after = &from
+	}
+	user := currentUser(c)
+	// the thread is checked before upgrading, refusals are plain HTTP errors
+	thread, err := h.chat.Thread(c.Request().Context(), id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// subscribed before the back-fill, what is sent meanwhile comes live
+	sub := h.hub.Subscribe(user.ID)
+	defer sub.Close()
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader has answered already
+		return nil
+	}
+	defer conn.Close()
+
+	s := &chatSession{
+		h:      h,
+		conn:   conn,
+		user:   user,
+		thread: thread,
+		out:    make(chan chatFrame, chatOutbox),
+	}
+	ctx := c.Request().Context()
+	if err := s.backfill(ctx, after); err != nil {
+		slog.Warn("chat: back-fill", "thread_id", thread.ID, "error", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.read(ctx, cancel)
+	s.write(ctx, sub)
+	return nil
+}
+
+// chatSession is one chat connection. Frames are only written by write,
+// read hands its answers over through out.
+type chatSession struct {
+	h      *chatHandler
+	conn   *websocket.Conn
+	user   *models.User
+	thread *models.ChatThread
+	out    chan chatFrame
+	// lastID is the last message sent by the back-fill
+	lastID uint
+}
+
+// backfill sends the messages after afterID, the whole thread for 0, then
+// synced. Without afterID there is nothing to send.
+func (s *chatSession) backfill(ctx context.Context, afterID *uint) error {
+	if afterID == nil {
+		return s.send(chatFrame{Type: "synced"})
+	}
+	s.lastID = *afterID
+	for {
+		msgs, err := s.h.chat.Since(ctx, s.thread.ID, s.lastID, replayBatch)
+		if err != nil {
+			return err
+		}
+		for i := range msgs {
+			if err := s.send(chatFrame{Type: "message", Message: &msgs[i]}); err != nil {
+				return err
+			}
+			s.lastID = msgs[i].ID
+		}
+		if len(msgs) < replayBatch {
+			break
+		}
+	}
+	return s.send(chatFrame{Type: "synced"})
+}
+
+func (s *chatSession) send(f chatFrame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return s.writeFrame(data)
+}
+
+// writeFrame writes the JSON frame data, chat events carry theirs encoded.
+func (s *chatSession) writeFrame(data []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(chatWriteWait))
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// write sends the frames of out and the chat events of the thread until
+// ctx is done, pinging the client.
+func (s *chatSession) write(ctx context.Context, sub *events.Subscription) {
+	ping := time.NewTicker(chatPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(chatWriteWait))
+			return
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(chatWriteWait)); err != nil {
+				return
+			}
+		case f := <-s.out:
+			if err := s.send(f); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// too far behind, the client reconnects with ?after
+				s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"), time.Now().Add(chatWriteWait))
+				return
+			}
+			if e.ThreadID != s.thread.ID {
+				continue
+			}
+			if e.Type == events.TypeMessage && e.ID <= s.lastID {
+				// sent by the back-fill
+				continue
+			}
+			if err := s.writeFrame(e.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// read handles the frames of the client until it leaves, then cancels the
+// session.
+func (s *chatSession) read(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	s.conn.SetReadLimit(chatMaxFrame)
+	s.conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+	for {
+		var f chatFrame
+		if err := s.conn.ReadJSON(&f); err != nil {
+			var syntax *json.SyntaxError
+			var typ *json.UnmarshalTypeError
+			if errors.As(err, &syntax) || errors.As(err, &typ) {
+				s.reply(ctx, chatFrame{Type: "error", Error: "frames must be JSON objects"})
+				continue
+			}
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(chatPongWait))
+
+		var err error
+		switch f.Type {
+		case "message":
+			err = s.message(ctx, f)
+		case "typing":
+			err = s.typing(ctx, f)
+		case "delivered":
+			err = s.delivered(ctx, f)
+		default:
+			err = echo.NewHTTPError(http.StatusBadRequest, "type must be one of message, typing, delivered")
+		}
+		if err != nil {
+			s.reply(ctx, chatFrame{Type: "error", ClientID: f.ClientID, Error: chatError(err)})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// reply queues f for the client.
+func (s *chatSession) reply(ctx context.Context, f chatFrame) {
+	select {
+	case s.out <- f:
+	case <-ctx.Done():
+	}
+}
+
+// chatError is what the client is told of err, the error body an HTTP
+// request would have got.
+func chatError(err error) string {
+	var forbidden *repository.ForbiddenError
+	var state *repository.StateError
+	var validation *validationError
+	var httpErr *echo.HTTPError
+	var duplicate *dberrors.ErrDuplicate
+	switch {
+	case errors.As(err, &forbidden), errors.As(err, &state), errors.As(err, &validation):
+		return err.Error()
+	case errors.As(err, &duplicate):
+		return "client_id is already used"
+	case errors.As(err, &httpErr):
+		if msg, ok := httpErr.Message.(string); ok {
+			return msg
+		}
+	}
+	slog.Error("chat: handling a frame", "error", err)
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+// message stores the message of f, acks it and publishes it to both
+// participants, the other connections of the sender included.
+func (s *chatSession) message(ctx context.Context, f chatFrame) error {
+	f.Body = strings.TrimSpace(f.Body)
+	switch {
+	case f.MessageType == "":
+		f.MessageType = models.MessageTypeText
+	case f.MessageType == models.MessageTypeSystem || !f.MessageType.IsValid():
+		return invalid("message_type", "must be one of text, image, file")
+	}
+	switch {
+	case len(f.ClientID) > 64:
+		return invalid("client_id", "is longer than 64 characters")
+	case f.MessageType == models.MessageTypeText && f.Body == "":
+		return invalid("body", "is required")
+	case len(f.Body) > chatMaxBody:
+		return invalid("body", "is longer than 10000 characters")
+	case f.MessageType != models.MessageTypeText && len(f.Attachments) == 0:
+		return invalid("attachments", "are required")
+	case len(f.Attachments) > chatMaxAttachments:
+		return invalid("attachments", "are more than 10")
+	}
+	for _, a := range f.Attachments {
+		if u, err := url.Parse(a); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid("attachments", "must be http(s) URLs")
+		}
+	}
+	attachments, err := json.Marshal(f.Attachments)
+	if err != nil {
+		return err
+	}
+	if f.Attachments == nil {
+		attachments = []byte("[]")
+	}
+
+	msg := models.Message{SenderID: s.user.ID, Type: f.MessageType, Body: f.Body, Attachments: string(attachments)}
+	if f.ClientID != "" {
+		msg.ClientID = &f.ClientID
+	}
+	stored, err := s.h.chat.Send(ctx, s.thread, &msg)
+	if err != nil {
+		return err
+	}
+	s.reply(ctx, chatFrame{Type: "ack", ClientID: f.ClientID, Message: &msg})
+	if !stored {
+		// sent again, the participants have it already
+		return nil
+	}
+	return s.publish(ctx, events.TypeMessage, msg.ID, chatFrame{Type: "message", Message: &msg}, s.participants()...)
+}
+
+// typing tells the other participant the user is (or stopped) typing.
+func (s *chatSession) typing(ctx context.Context, f chatFrame) error {
+	typing := f.Typing == nil || *f.Typing
+	return s.publish(ctx, events.TypeTyping, 0, chatFrame{Type: "typing", UserID: s.user.ID, Typing: &typing}, s.others()...)
+}
+
+// delivered marks the messages up to f.MessageID delivered and tells their
+// sender.
+func (s *chatSession) delivered(ctx context.Context, f chatFrame) error {
+	if f.MessageID == 0 {
+		return invalid("message_id", "is required")
+	}
+	at, err := s.h.chat.MarkDelivered(ctx, s.thread.ID, s.user.ID, f.MessageID)
+	if err != nil || at == nil {
+		return err
+	}
+	return s.publish(ctx, events.TypeDelivered, 0, chatFrame{Type: "delivered", UserID: s.user.ID, MessageID: f.MessageID, DeliveredAt: at}, s.others()...)
+}
+
+func (s *chatSession) publish(ctx context.Context, typ string, id uint, f chatFrame, userIDs ...uint) error {
+	evs, err := events.ChatEvents(typ, s.thread.ID, id, f, userIDs...)
+	if err != nil {
+		return err
+	}
+	for _, e := range evs {
+		if err := s.h.hub.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// participants are the requester and the responder of the thread's exchange.
+func (s *chatSession) participants() []uint {
+	ex := s.thread.Exchange
+	ids := []uint{ex.RequesterID}
+	if ex.ResponderID != nil {
+		ids = append(ids, *ex.ResponderID)
+	}
+	return ids
+}
+
+// others are the participants but the user.
+func (s *chatSession) others() []uint {
+	return slices.DeleteFunc(s.participants(), func(id uint) bool { return id == s.user.ID })
+}
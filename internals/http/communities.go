@@ -0,0 +1,348 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type communityHandler struct {
+	communities *repository.CommunityRepository
+}
+
+var (
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugUnsafe  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// slugify makes a slug out of a community name, "Sci-Fi & Fantasy" becomes
+// sci-fi-fantasy.
+func slugify(name string) string {
+	return strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// list serves GET /communities, filtered and sorted by the query (see
+// models.Community.FilterSpec), slug[like]=book finds them by slug.
+func (h *communityHandler) list(c echo.Context) error {
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.communities.List(c.Request().Context(), c.QueryParams(), req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// get serves GET /communities/:slug.
+func (h *communityHandler) get(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, community)
+}
+
+type communityInput struct {
+	Name            string `json:"name"`
+	Slug            string `json:"slug"`
+	Description     string `json:"description"`
+	RequirePaidChat bool   `json:"require_paid_chat"`
+}
+
+// create serves POST /communities, the caller becomes its admin. The slug is
+// made from the name when left out.
+func (h *communityHandler) create(c echo.Context) error {
+	var in communityInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Slug == "" {
+		in.Slug = slugify(in.Name)
+	}
+	switch {
+	case in.Name == "":
+		return invalid("name", "is required")
+	case len(in.Name) > 255:
+		return invalid("name", "is longer than 255 characters")
+	case len(in.Slug) > 255:
+		return invalid("slug", "is longer than 255 characters")
+	case !slugPattern.MatchString(in.Slug):
+		return invalid("slug", "must be lowercase letters and digits separated by dashes")
+	}
+
+	community := models.Community{
+		Name:            in.Name,
+		Slug:            in.Slug,
+		Description:     strings.TrimSpace(in.Description),
+		CreatorID:       currentUser(c).ID,
+		RequirePaidChat: in.RequirePaidChat,
+	}
+	ctx := c.Request().Context()
+	if err := h.communities.Create(ctx, &community); err != nil {
+		return err
+	}
+	created, err := h.communities.GetBySlug(ctx, community.Slug)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+// join serves POST /communities/:slug/join.
+func (h *communityHandler) join(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	member, err := h.communities.Join(c.Request().Context(), community.ID, currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, member)
+}
+
+// leave serves POST /communities/:slug/leave.
+func (h *communityHandler) leave(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	if err := h.communities.Leave(c.Request().Context(), community.ID, currentUser(c).ID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// members serves GET /communities/:slug/members, role=moderator lists the
+// members with that role.
+func (h *communityHandler) members(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	role := models.CommunityRole(c.QueryParam("role"))
+	if role != "" && !role.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "role must be one of member, moderator, admin")
+	}
+	page, err := h.communities.Members(c.Request().Context(), community.ID, role, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+type roleInput struct {
+	CommunityRole models.CommunityRole `json:"community_role"`
+}
+
+// setRole serves PATCH /communities/:slug/members/:user_id, admins only.
+func (h *communityHandler) setRole(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	userID, err := pathID(c, "user_id")
+	if err != nil {
+		return err
+	}
+	var in roleInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	if !in.CommunityRole.IsValid() {
+		return invalid("community_role", "must be one of member, moderator, admin")
+	}
+	member, err := h.communities.SetRole(c.Request().Context(), community.ID, currentUser(c).ID, userID, in.CommunityRole)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, member)
+}
+
+// removeMember serves DELETE /communities/:slug/members/:user_id, admins and
+// moderators only.
+func (h *communityHandler) removeMember(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	userID, err := pathID(c, "user_id")
+	if err != nil {
+		return err
+	}
+	if err := h.communities.RemoveMember(c.Request().Context(), community.ID, currentUser(c).ID, userID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// threads serves GET /communities/:slug/threads, pinned ones first.
+func (h *communityHandler) threads(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.communities.Threads(c.Request().Context(), community.ID, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+type threadInput struct {
+	Title string `json:"title"`
+}
+
+// createThread serves POST /communities/:slug/threads, members only.
+func (h *communityHandler) createThread(c echo.Context) error {
+	community, err := h.community(c)
+	if err != nil {
+		return err
+	}
+	var in threadInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.Title = strings.TrimSpace(in.Title)
+	switch {
+	case in.Title == "":
+		return invalid("title", "is required")
+	case len(in.Title) > 500:
+		return invalid("title", "is longer than 500 characters")
+	}
+
+	thread := models.CommunityThread{CommunityID: community.ID, CreatedBy: currentUser(c).ID, Title: in.Title}
+	ctx := c.Request().Context()
+	if err := h.communities.CreateThread(ctx, &thread); err != nil {
+		return err
+	}
+	created, err := h.communities.GetThread(ctx, community.ID, thread.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+// pin serves POST (pin) and DELETE (unpin) /communities/:slug/threads/:thread_id/pin,
+// admins and moderators only.
+func (h *communityHandler) pin(pinned bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		community, err := h.community(c)
+		if err != nil {
+			return err
+		}
+		threadID, err := pathID(c, "thread_id")
+		if err != nil {
+			return err
+		}
+		thread, err := h.communities.Pin(c.Request().Context(), community.ID, threadID, currentUser(c).ID, pinned)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, thread)
+	}
+}
+
+// messages serves GET /communities/:slug/threads/:thread_id/messages, newest
+// first.
+func (h *communityHandler) messages(c echo.Context) error {
+	_, thread, err := h.thread(c)
+	if err != nil {
+		return err
+	}
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.communities.Messages(c.Request().Context(), thread.ID, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+type messageInput struct {
+	Body string `json:"body"`
+}
+
+// postMessage serves POST /communities/:slug/threads/:thread_id/messages,
+// members only.
+func (h *communityHandler) postMessage(c echo.Context) error {
+	community, thread, err := h.thread(c)
+	if err != nil {
+		return err
+	}
+	var in messageInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.Body = strings.TrimSpace(in.Body)
+	switch {
+	case in.Body == "":
+		return invalid("body", "is required")
+	case len(in.Body) > 10000:
+		return invalid("body", "is longer than 10000 characters")
+	}
+
+	msg := models.CommunityMessage{ThreadID: thread.ID, SenderID: currentUser(c).ID, Body: in.Body}
+	if err := h.communities.PostMessage(c.Request().Context(), community.ID, &msg); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, msg)
+}
+
+// removeMessage serves DELETE
+// /communities/:slug/threads/:thread_id/messages/:message_id, the sender,
+// admins and moderators only.
+func (h *communityHandler) removeMessage(c echo.Context) error {
+	community, thread, err := h.thread(c)
+	if err != nil {
+		return err
+	}
+	messageID, err := pathID(c, "message_id")
+	if err != nil {
+		return err
+	}
+	if err := h.communities.RemoveMessage(c.Request().Context(), community.ID, thread.ID, messageID, currentUser(c).ID); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// community returns the community of the :slug path parameter.
+func (h *communityHandler) community(c echo.Context) (*models.Community, error) {
+	return h.communities.GetBySlug(c.Request().Context(), c.Param("slug"))
+}
+
+// thread returns the community of the :slug path parameter and its thread
+// of :thread_id, a 404 when the thread is another community's.
+func (h *communityHandler) thread(c echo.Context) (*models.Community, *models.CommunityThread, error) {
+	community, err := h.community(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	threadID, err := pathID(c, "thread_id")
+	if err != nil {
+		return nil, nil, err
+	}
+	thread, err := h.communities.GetThread(c.Request().Context(), community.ID, threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return community, thread, nil
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// errorBody is the JSON body of every error response.
+type errorBody struct {
+	Error string `json:"error"`
+	// Field is the offending field of a duplicate, foreign key or check
+	// violation, or the rejected query parameter, when known.
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// validationError is a request body field a handler rejected.
+type validationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *validationError) Error() string { return e.Field + ": " + e.Reason }
+
+func invalid(field, reason string) error {
+	return &validationError{Field: field, Reason: reason}
+}
+
+// errorHandler answers a request whose handler returned err.
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	code, body := errorResponse(err)
+	if code >= http.StatusInternalServerError {
+		// don't leak driver messages, the access log has the error
+		body = errorBody{Error: http.StatusText(code)}
+	}
+	body.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(code)
+	} else {
+		err = c.JSON(code, body)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// errorResponse maps err to a status code and body.
+func errorResponse(err error) (int, errorBody) {
+	var (
+		he       *echo.HTTPError
+		nf       *dberrors.ErrNotFound
+		dup      *dberrors.ErrDuplicate
+		conflict *dberrors.ErrConflict
+		fk       *dberrors.ErrForeignKey
+		chk      *dberrors.ErrCheck
+		fe       *filter.Error
+		ve       *validationError
+		fbd      *repository.ForbiddenError
+		state    *repository.StateError
+	)
+	switch {
+	case errors.As(err, &he):
+		msg := fmt.Sprint(he.Message)
+		if m, ok := he.Message.(string); ok {
+			msg = m
+		}
+		return he.Code, errorBody{Error: msg}
+	case errors.As(err, &nf):
+		return http.StatusNotFound, errorBody{Error: nf.Error()}
+	case errors.As(err, &dup):
+		return http.StatusConflict, errorBody{Error: dup.Error(), Field: dup.Field}
+	case errors.As(err, &conflict):
+		return http.StatusConflict, errorBody{Error: conflict.Error()}
+	case errors.As(err, &fk):
+		return http.StatusUnprocessableEntity, errorBody{Error: fk.Error(), Field: fk.Field}
+	case errors.As(err, &chk):
+		return http.StatusUnprocessableEntity, errorBody{Error: chk.Error(), Field: chk.Field}
+	case errors.As(err, &fe):
+		return http.StatusBadRequest, errorBody{Error: fe.Reason, Field: fe.Param}
+	case errors.Is(err, pagination.ErrInvalidCursor):
+		return http.StatusBadRequest, errorBody{Error: "invalid cursor"}
+	case errors.As(err, &ve):
+		return http.StatusUnprocessableEntity, errorBody{Error: ve.Reason, Field: ve.Field}
+	case errors.As(err, &fbd):
+		return http.StatusForbidden, errorBody{Error: fbd.Error()}
+	case errors.As(err, &state):
+		return http.StatusConflict, errorBody{Error: state.Error()}
+	case errors.Is(err, auth.ErrUnauthenticated), errors.Is(err, auth.ErrInvalidCredentials):
+		return http.StatusUnauthorized, errorBody{Error: err.Error()}
+	case errors.Is(err, auth.ErrDeactivated):
+		return http.StatusForbidden, errorBody{Error: err.Error()}
+	}
+	return http.StatusInternalServerError, errorBody{}
+}
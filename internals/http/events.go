@@ -0,0 +1,157 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/events"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// streamRetry is how long a client waits before reconnecting a dropped
+	// stream.
+	streamRetry = 3 * time.Second
+	// replayBatch is how many missed notifications are read at once.
+	replayBatch = 100
+	// sentWindow is how long the ids of the notifications a stream sent are
+	// kept, not to send again those that are both replayed and published.
+	sentWindow = time.Minute
+)
+
+type eventHandler struct {
+	hub           *events.Hub
+	notifications *repository.NotificationRepository
+	heartbeat     time.Duration
+}
+
+// stream serves GET /me/events, the caller's events as server-sent events.
+// Notification events carry the notification's id, a client reconnecting
+// with it in Last-Event-ID (or ?last_event_id= when it can't set headers)
+// first gets the notifications it missed, and those created shortly before
+// it (see NotificationRepository.ResumeAfter): clients tell notifications
+// they already have by their id. The stream ends when the client leaves, or
+// when it falls too far behind; it then reconnects and resumes.
+func (h *eventHandler) stream(c echo.Context) error {
+	var lastID uint
+	if raw := c.Request().Header.Get("Last-Event-ID"); raw != "" || c.QueryParam("last_event_id") != "" {
+		if raw == "" {
+			raw = c.QueryParam("last_event_id")
+		}
+		id, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "last event id must be a non-negative integer")
+		}
+		lastID = uint(id)
+	}
+
+	ctx := c.Request().Context()
+	userID := currentUser(c).ID
+	// subscribed before replaying, what is created meanwhile comes live
+	sub := h.hub.Subscribe(userID)
+	defer sub.Close()
+
+	// the server's write timeout would cut the stream
+	rc := http.NewResponseController(c.Response())
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set(echo.HeaderCacheControl, "no-cache")
+	header.Set(echo.HeaderConnection, "keep-alive")
+	// no buffering by a proxy in front (nginx)
+	header.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := c.Response()
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return nil
+	}
+	// the notifications sent, with when, within sentWindow
+	sent := map[uint]time.Time{}
+	if lastID > 0 {
+		after, err := h.notifications.ResumeAfter(ctx, userID, lastID, events.Overlap)
+		if err != nil {
+			// the response is committed, the error can only be logged
+			return err
+		}
+		for {
+			missed, err := h.notifications.Since(ctx, userID, after, replayBatch)
+			if err != nil {
+				return err
+			}
+			for i := range missed {
+				e, err := events.NotificationEvent(&missed[i])
+				if err != nil {
+					return err
+				}
+				if err := writeEvent(w, e); err != nil {
+					return nil
+				}
+				sent[e.ID] = time.Now()
+				after = e.ID
+			}
+			if len(missed) < replayBatch {
+				break
+			}
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			// keeps proxies from closing an idle connection
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			for id, at := range sent {
+				if time.Since(at) > sentWindow {
+					delete(sent, id)
+				}
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// too far behind, the client resumes from its last event
+				return nil
+			}
+			if e.ThreadID != 0 {
+				// chat events are for the chat sockets
+				continue
+			}
+			if _, ok := sent[e.ID]; ok && e.ID != 0 {
+				// sent by the replay already
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return nil
+			}
+			if e.ID != 0 {
+				sent[e.ID] = time.Now()
+			}
+		}
+		w.Flush()
+	}
+}
+
+// writeEvent writes e in the text/event-stream format, with an id when it
+// can be replayed.
+func writeEvent(w *echo.Response, e events.Event) error {
+	if e.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.ID); err != nil {
+			return err
+		}
+	}
+	// the data is compact JSON, a single line
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+	return err
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type exchangeHandler struct {
+	exchanges *repository.ExchangeRepository
+}
+
+// list serves GET /exchanges: the caller's exchanges, filtered by the query
+// (see models.Exchange.FilterSpec).
+func (h *exchangeHandler) list(c echo.Context) error {
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.exchanges.List(c.Request().Context(), currentUser(c).ID, c.QueryParams(), req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// get serves GET /exchanges/:id, participants only.
+func (h *exchangeHandler) get(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	ex, err := h.exchanges.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	userID := currentUser(c).ID
+	if ex.RequesterID != userID && (ex.ResponderID == nil || *ex.ResponderID != userID) {
+		return echo.NewHTTPError(http.StatusForbidden, "you don't take part in this exchange")
+	}
+	return c.JSON(http.StatusOK, ex)
+}
+
+type exchangeInput struct {
+	ResponderBookID  uint       `json:"responder_book_id"`
+	RequesterBookID  *uint      `json:"requester_book_id"`
+	ShippingRequired *bool      `json:"shipping_required"`
+	AgreedStartDate  *time.Time `json:"agreed_start_date"`
+	AgreedEndDate    *time.Time `json:"agreed_end_date"`
+}
+
+// request serves POST /exchanges: the caller asks the owner of
+// responder_book_id for it.
+func (h *exchangeHandler) request(c echo.Context) error {
+	var in exchangeInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	switch {
+	case in.ResponderBookID == 0:
+		return invalid("responder_book_id", "is required")
+	case in.AgreedStartDate != nil && in.AgreedEndDate != nil && in.AgreedEndDate.Before(*in.AgreedStartDate):
+		return invalid("agreed_end_date", "is before agreed_start_date")
+	}
+
+	req := repository.ExchangeRequest{
+		RequesterID:      currentUser(c).ID,
+		ResponderBookID:  in.ResponderBookID,
+		RequesterBookID:  in.RequesterBookID,
+		ShippingRequired: true,
+		AgreedStartDate:  in.AgreedStartDate,
+		AgreedEndDate:    in.AgreedEndDate,
+	}
+	if in.ShippingRequired != nil {
+		req.ShippingRequired = *in.ShippingRequired
+	}
+	ex, err := h.exchanges.Request(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, ex)
+}
+
+// transition serves the workflow steps without a body, POST
+// /exchanges/:id/accept and friends, take being the repository's step.
+func (h *exchangeHandler) transition(take func(ctx context.Context, id, userID uint) (*models.Exchange, error)) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := pathID(c, "id")
+		if err != nil {
+			return err
+		}
+		ex, err := take(c.Request().Context(), id, currentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, ex)
+	}
+}
+
+type shipInput struct {
+	Provider       string `json:"provider"`
+	TrackingNumber string `json:"tracking_number"`
+}
+
+// ship serves POST /exchanges/:id/ship.
+func (h *exchangeHandler) ship(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	var in shipInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.TrackingNumber = strings.TrimSpace(in.TrackingNumber)
+	if in.TrackingNumber == "" {
+		return invalid("tracking_number", "is required")
+	}
+	ex, err := h.exchanges.Ship(c.Request().Context(), id, currentUser(c).ID, strings.TrimSpace(in.Provider), in.TrackingNumber)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, ex)
+}
+
+type disputeInput struct {
+	Reason string `json:"reason"`
+}
+
+// dispute serves POST /exchanges/:id/dispute.
+func (h *exchangeHandler) dispute(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	var in disputeInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Reason == "" {
+		return invalid("reason", "is required")
+	}
+	ex, err := h.exchanges.Dispute(c.Request().Context(), id, currentUser(c).ID, in.Reason)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, ex)
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// checkTimeout bounds each readiness check and diagnostic query, a probe
+// must answer well within the orchestrator's own timeout.
+const checkTimeout = 2 * time.Second
+
+type healthHandler struct {
+	db     *gorm.DB
+	tx     *txmanager.Manager
+	config *config.Container
+}
+
+// check is the outcome of one readiness check, Error is empty when it
+// passed. /readyz is public: Error is a fixed reason, the error behind it
+// is logged (and /debug/db tells it to admins).
+type check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+type readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]check `json:"checks"`
+}
+
+// live serves GET /healthz: the process is up and serving requests.
+func (h *healthHandler) live(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready serves GET /readyz: the database answers, has been migrated to this
+// build's schema version and the configuration is complete. It is a 503
+// until then.
+func (h *healthHandler) ready(c echo.Context) error {
+	ctx := c.Request().Context()
+	r := readiness{Ready: true, Checks: map[string]check{
+		"database":   h.check(ctx, "database", "database unreachable", h.ping),
+		"migrations": h.check(ctx, "migrations", "schema version of this build not applied", h.migrated),
+		"config":     h.check(ctx, "config", "configuration incomplete", h.configured),
+	}}
+	code := http.StatusOK
+	for _, c := range r.Checks {
+		if !c.OK {
+			r.Ready = false
+			code = http.StatusServiceUnavailable
+		}
+	}
+	return c.JSON(code, r)
+}
+
+// check runs the check name, reason being what a failure is reported as.
+func (h *healthHandler) check(ctx context.Context, name, reason string, fn func(context.Context) error) check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		slog.Warn("readiness check failed", "check", name, "error", err)
+		return check{Error: reason}
+	}
+	return check{OK: true}
+}
+
+func (h *healthHandler) ping(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (h *healthHandler) migrated(ctx context.Context) error {
+	want, err := database.SchemaVersion(h.db)
+	if err != nil {
+		return err
+	}
+	applied, err := database.AppliedMigration(ctx, h.db)
+	switch {
+	case err != nil:
+		return err
+	case applied == nil:
+		return fmt.Errorf("schema version %s not applied, the database was never migrated", want)
+	case applied.Version != want:
+		return fmt.Errorf("schema version %s not applied, the last one is %s", want, applied.Version)
+	}
+	return nil
+}
+
+func (h *healthHandler) configured(context.Context) error {
+	if missing := h.config.Missing(); len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// dbDiagnostics is the body of /debug/db. Every field is always present,
+// those that couldn't be read are null and say why in Errors.
+type dbDiagnostics struct {
+	Pool         poolStats       `json:"pool"`
+	Migration    migration       `json:"migration"`
+	Replica      replica         `json:"replica"`
+	Transactions txmanager.Stats `json:"transactions"`
+	Errors       []string        `json:"errors"`
+}
+
+type poolStats struct {
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitSeconds       float64 `json:"wait_seconds"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+type migration struct {
+	// Expected is the schema version of this build, Applied the last one
+	// migrated to.
+	Expected  string     `json:"expected"`
+	Applied   *string    `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+type replica struct {
+	IsReplica  *bool    `json:"is_replica"`
+	LagSeconds *float64 `json:"lag_seconds"`
+}
+
+// dbStats serves GET /debug/db, admins only.
+func (h *healthHandler) dbStats(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), checkTimeout)
+	defer cancel()
+	d := dbDiagnostics{Transactions: h.tx.Stats(), Errors: []string{}}
+	fail := func(what string, err error) {
+		d.Errors = append(d.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	if sqlDB, err := h.db.DB(); err != nil {
+		fail("pool", err)
+	} else {
+		s := sqlDB.Stats()
+		d.Pool = poolStats{
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitSeconds:       s.WaitDuration.Seconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		}
+	}
+
+	if version, err := database.SchemaVersion(h.db); err != nil {
+		fail("migration", err)
+	} else {
+		d.Migration.Expected = version
+	}
+	if applied, err := database.AppliedMigration(ctx, h.db); err != nil {
+		fail("migration", err)
+	} else if applied != nil {
+		d.Migration.Applied, d.Migration.AppliedAt = &applied.Version, &applied.AppliedAt
+	}
+
+	if isReplica, lag, err := database.ReplicaLag(ctx, h.db); err != nil {
+		fail("replica", err)
+	} else {
+		d.Replica.IsReplica = &isReplica
+		if lag != nil {
+			seconds := lag.Seconds()
+			d.Replica.LagSeconds = &seconds
+		}
+	}
+	return c.JSON(http.StatusOK, d)
+}
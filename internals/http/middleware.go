@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// useMiddleware installs the middleware every request goes through, outermost
+// first.
+func useMiddleware(e *echo.Echo, cfg *config.HTTP, logger *slog.Logger) {
+	// the id is set first so that everything after it can log it
+	e.Use(middleware.RequestID())
+	e.Use(accessLog(logger))
+	// inside the access log, a panic is logged as the 500 it turns into
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  cfg.AllowOrigins,
+		ExposeHeaders: []string{echo.HeaderXRequestID},
+	}))
+	e.Use(middleware.BodyLimit(cfg.BodyLimit))
+	e.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+		Skipper: streaming,
+		Timeout: cfg.RequestTimeout,
+	}))
+}
+
+// streamRoutes are the routes holding their connection open for as long as
+// the client wants, the request timeout doesn't apply to them.
+var streamRoutes = map[string]bool{
+	"/api/v1/me/events":          true,
+	"/api/v1/exchanges/:id/chat": true,
+}
+
+func streaming(c echo.Context) bool { return streamRoutes[c.Path()] }
+
+// accessLog logs one JSON line per request once it has been answered.
+func accessLog(logger *slog.Logger) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		// probes hit every few seconds, /readyz tells its failures itself
+		Skipper: func(c echo.Context) bool {
+			path := c.Request().URL.Path
+			return path == "/healthz" || path == "/readyz"
+		},
+		// run the error handler first so the status logged is the one sent
+		HandleError:     true,
+		LogLatency:      true,
+		LogRemoteIP:     true,
+		LogMethod:       true,
+		LogURI:          true,
+		LogRoutePath:    true,
+		LogRequestID:    true,
+		LogUserAgent:    true,
+		LogStatus:       true,
+		LogError:        true,
+		LogResponseSize: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= 500:
+				level = slog.LevelError
+			case v.Status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", v.RequestID),
+				slog.String("method", v.Method),
+				slog.String("uri", redactToken(v.URI)),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.Int64("size", v.ResponseSize),
+				slog.String("remote_ip", v.RemoteIP),
+				slog.String("user_agent", v.UserAgent),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			logger.LogAttrs(context.Background(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// redactToken hides the access token streams may carry in their query (see
+// auth.BearerToken) from the access log.
+func redactToken(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || !strings.Contains(query, "access_token=") {
+		return uri
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return path
+	}
+	values.Set("access_token", "REDACTED")
+	return path + "?" + values.Encode()
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type notificationHandler struct {
+	notifications *repository.NotificationRepository
+}
+
+// list serves GET /me/notifications, newest first, filtered by the query (see
+// models.Notification.FilterSpec): type[in]=exchange_shipped,exchange_delivered
+// or read=false.
+func (h *notificationHandler) list(c echo.Context) error {
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.notifications.List(c.Request().Context(), currentUser(c).ID, c.QueryParams(), req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// unreadCount serves GET /me/notifications/unread_count.
+func (h *notificationHandler) unreadCount(c echo.Context) error {
+	n, err := h.notifications.UnreadCount(c.Request().Context(), currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"unread": n})
+}
+
+type readInput struct {
+	Read *bool `json:"read"`
+}
+
+// setRead serves PATCH /me/notifications/:id, {"read": false} marks it unread
+// again.
+func (h *notificationHandler) setRead(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	var in readInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	if in.Read == nil {
+		return invalid("read", "is required")
+	}
+	n, err := h.notifications.SetRead(c.Request().Context(), currentUser(c).ID, id, *in.Read)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, n)
+}
+
+// readAll serves POST /me/notifications/read_all, the query narrows it down
+// like the inbox's, e.g. type=exchange_shipped.
+func (h *notificationHandler) readAll(c echo.Context) error {
+	n, err := h.notifications.MarkAllRead(c.Request().Context(), currentUser(c).ID, c.QueryParams())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"updated": n})
+}
+
+// delete serves DELETE /me/notifications/:id.
+func (h *notificationHandler) delete(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.notifications.Delete(c.Request().Context(), currentUser(c).ID, id); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
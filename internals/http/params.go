@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+// pathID reads the id path parameter name.
+func pathID(c echo.Context, name string) (uint, error) {
+	var id uint
+	if err := echo.PathParamsBinder(c).MustUint(name, &id).BindError(); err != nil || id == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, name+" must be a positive integer")
+	}
+	return id, nil
+}
+
+// pageRequest reads the limit, after and before query parameters.
+func pageRequest(c echo.Context) (pagination.Request, error) {
+	var req pagination.Request
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+		return req, echo.NewHTTPError(http.StatusBadRequest, "limit must be an integer")
+	}
+	if req.After != "" && req.Before != "" {
+		return req, echo.NewHTTPError(http.StatusBadRequest, "after and before can't be used together")
+	}
+	return req, nil
+}
+
+// bindBody decodes the JSON body of the request into dest, path and query
+// parameters aren't looked at.
+func bindBody(c echo.Context, dest any) error {
+	if err := (&echo.DefaultBinder{}).BindBody(c, dest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "malformed request body")
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Package http is the HTTP API, an Echo server.
+//
+// Every request goes through the same middleware: panics are recovered into a
+// 500, it gets an X-Request-ID (the client's one if it sent one), it is
+// logged as one JSON line once answered, CORS and the body size limit are
+// enforced and its context is cancelled after the request timeout, taking the
+// queries it runs with it; streams (/me/events, the chat WebSockets) are only
+// ended by the client.
+//
+// Routes are versioned, everything but the probes (/healthz, /readyz) and
+// the admin diagnostics (/debug/db) lives under /api/v1. Handlers don't reach
+// for globals, they get the repositories they need through Deps:
+//
+//	srv := http.New(config.HTTP, http.Deps{DB: db, Config: config, Repos: repository.New(tm), Auth: sessions, Events: hub, Sessions: sessions})
+//	err := srv.Start(ctx) // until ctx is done
+//
+// Errors returned by handlers are turned into JSON by errorHandler, typed
+// dberrors included (not found is a 404, a duplicate a 409, ...).
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/auth"
+	"github.com/Amanuel-0/gorm-pg/internals/config"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/events"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// shutdownTimeout is how long Start waits for in-flight requests once its
+// context is done.
+const shutdownTimeout = 10 * time.Second
+
+// Deps are what the handlers are built from.
+type Deps struct {
+	// DB is only used for health checks and diagnostics, handlers go through
+	// Repos.
+	DB     *gorm.DB
+	Config *config.Container
+	Repos  *repository.Repositories
+	// Auth tells who sent a request, routes needing a user answer 401
+	// without it.
+	Auth Authenticator
+	// Events streams the live events of /me/events.
+	Events *events.Hub
+	// Sessions registers users and logs them in and out, the /auth routes
+	// are left out without it.
+	Sessions *auth.Service
+}
+
+// Server is the API server.
+type Server struct {
+	echo   *echo.Echo
+	server *http.Server
+}
+
+// New returns a Server configured by cfg, its routes registered.
+func New(cfg *config.HTTP, deps Deps) *Server {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = errorHandler
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	useMiddleware(e, cfg, logger)
+	routes(e, deps)
+
+	return &Server{
+		echo: e,
+		server: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           e,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+	}
+}
+
+// Handler returns the handler serving the API, e.g. for httptest.
+func (s *Server) Handler() http.Handler { return s.echo }
+
+// Start serves the API until ctx is done, then shuts down gracefully.
+func (s *Server) Start(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP server listening on %s", s.server.Addr)
+		errc <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("HTTP server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// routes registers the routes of every API version.
+func routes(e *echo.Echo, deps Deps) {
+	// probes and diagnostics aren't versioned
+	health := &healthHandler{db: deps.DB, tx: deps.Repos.Tx, config: deps.Config}
+	e.GET("/healthz", health.live)
+	e.GET("/readyz", health.ready)
+	e.GET("/debug/db", health.dbStats, requireUser(deps.Auth), requireRole(models.RoleAdmin))
+
+	v1 := e.Group("/api/v1")
+	auth := requireUser(deps.Auth)
+
+	if deps.Sessions != nil {
+		accounts := &accountHandler{sessions: deps.Sessions}
+		v1.POST("/auth/register", accounts.register)
+		v1.POST("/auth/login", accounts.login)
+		v1.POST("/auth/logout", accounts.logout, auth)
+	}
+
+	users := &userHandler{users: deps.Repos.Users}
+	v1.GET("/users/:id", users.get)
+
+	books := &bookHandler{books: deps.Repos.Books}
+	v1.GET("/books", books.list)
+	v1.POST("/books", books.create, auth)
+	v1.GET("/books/:id", books.get)
+	v1.PATCH("/books/:id", books.update, auth)
+	v1.DELETE("/books/:id", books.delete, auth)
+	v1.GET("/books/:id/images", books.images)
+	v1.POST("/books/:id/images", books.addImage, auth)
+	v1.DELETE("/books/:id/images/:image_id", books.deleteImage, auth)
+	v1.GET("/books/:id/reviews", books.reviews)
+	v1.POST("/books/:id/reviews", books.addReview, auth)
+	v1.DELETE("/books/:id/reviews/:review_id", books.deleteReview, auth)
+
+	exchanges := &exchangeHandler{exchanges: deps.Repos.Exchanges}
+	ex := v1.Group("/exchanges", auth)
+	ex.GET("", exchanges.list)
+	ex.POST("", exchanges.request)
+	ex.GET("/:id", exchanges.get)
+	ex.POST("/:id/accept", exchanges.transition(deps.Repos.Exchanges.Accept))
+	ex.POST("/:id/decline", exchanges.transition(deps.Repos.Exchanges.Decline))
+	ex.POST("/:id/ship", exchanges.ship)
+	ex.POST("/:id/deliver", exchanges.transition(deps.Repos.Exchanges.Deliver))
+	ex.POST("/:id/complete", exchanges.transition(deps.Repos.Exchanges.Complete))
+	ex.POST("/:id/cancel", exchanges.transition(deps.Repos.Exchanges.Cancel))
+	ex.POST("/:id/dispute", exchanges.dispute)
+	// a WebSocket, see streamRoutes
+	if deps.Events.CarriesPublished() {
+		chat := newChatHandler(deps.Repos.Chat, deps.Events, deps.Config.HTTP.AllowOrigins)
+		ex.GET("/:id/chat", chat.connect)
+	} else {
+		slog.Warn("http: the chat is off, the poll events backend can't carry its messages; use local or redis")
+		ex.GET("/:id/chat", func(echo.Context) error {
+			return echo.NewHTTPError(http.StatusNotImplemented, "chat is not available with the poll events backend")
+		})
+	}
+
+	communities := &communityHandler{communities: deps.Repos.Communities}
+	v1.GET("/communities", communities.list)
+	v1.POST("/communities", communities.create, auth)
+	v1.GET("/communities/:slug", communities.get)
+	v1.POST("/communities/:slug/join", communities.join, auth)
+	v1.POST("/communities/:slug/leave", communities.leave, auth)
+	v1.GET("/communities/:slug/members", communities.members)
+	v1.PATCH("/communities/:slug/members/:user_id", communities.setRole, auth)
+	v1.DELETE("/communities/:slug/members/:user_id", communities.removeMember, auth)
+	v1.GET("/communities/:slug/threads", communities.threads)
+	v1.POST("/communities/:slug/threads", communities.createThread, auth)
+	v1.POST("/communities/:slug/threads/:thread_id/pin", communities.pin(true), auth)
+	v1.DELETE("/communities/:slug/threads/:thread_id/pin", communities.pin(false), auth)
+	v1.GET("/communities/:slug/threads/:thread_id/messages", communities.messages)
+	v1.POST("/communities/:slug/threads/:thread_id/messages", communities.postMessage, auth)
+	v1.DELETE("/communities/:slug/threads/:thread_id/messages/:message_id", communities.removeMessage, auth)
+
+	subscriptions := &subscriptionHandler{subscriptions: deps.Repos.Subscriptions}
+	v1.GET("/plans", subscriptions.plans)
+
+	// the caller's own resources
+	me := v1.Group("/me", auth)
+	me.GET("/subscription", subscriptions.current)
+	me.POST("/subscription", subscriptions.subscribe)
+	me.POST("/subscription/cancel", subscriptions.cancel)
+	me.POST("/subscription/resume", subscriptions.resume)
+	me.GET("/payments", subscriptions.payments)
+
+	notifications := &notificationHandler{notifications: deps.Repos.Notifications}
+	me.GET("/notifications", notifications.list)
+	me.GET("/notifications/unread_count", notifications.unreadCount)
+	me.POST("/notifications/read_all", notifications.readAll)
+	me.PATCH("/notifications/:id", notifications.setRead)
+	me.DELETE("/notifications/:id", notifications.delete)
+
+	// a stream, see streamRoutes
+	stream := &eventHandler{hub: deps.Events, notifications: deps.Repos.Notifications, heartbeat: deps.Config.Events.Heartbeat}
+	me.GET("/events", stream.stream)
+}
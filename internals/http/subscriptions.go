@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type subscriptionHandler struct {
+	subscriptions *repository.SubscriptionRepository
+}
+
+// planResponse is a plan with its features decoded, null when it has none.
+type planResponse struct {
+	models.SubscriptionPlan
+	Features any `json:"features"`
+}
+
+// plans serves GET /plans, the plans that can be subscribed to.
+func (h *subscriptionHandler) plans(c echo.Context) error {
+	plans, err := h.subscriptions.Plans(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	out := make([]planResponse, len(plans))
+	for i, plan := range plans {
+		out[i].SubscriptionPlan = plan
+		if len(plan.Features) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(plan.Features, &out[i].Features); err != nil {
+			return fmt.Errorf("plan %d features: %w", plan.ID, err)
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// current serves GET /me/subscription, a 404 without one.
+func (h *subscriptionHandler) current(c echo.Context) error {
+	sub, err := h.subscriptions.Current(c.Request().Context(), currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sub)
+}
+
+type subscribeInput struct {
+	PlanID uint `json:"plan_id"`
+}
+
+// subscribe serves POST /me/subscription, a 409 while the caller has a
+// current subscription.
+func (h *subscriptionHandler) subscribe(c echo.Context) error {
+	var in subscribeInput
+	if err := bindBody(c, &in); err != nil {
+		return err
+	}
+	if in.PlanID == 0 {
+		return invalid("plan_id", "is required")
+	}
+	sub, err := h.subscriptions.Subscribe(c.Request().Context(), currentUser(c).ID, in.PlanID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, sub)
+}
+
+// cancel serves POST /me/subscription/cancel, the subscription ends with its
+// period.
+func (h *subscriptionHandler) cancel(c echo.Context) error {
+	sub, err := h.subscriptions.Cancel(c.Request().Context(), currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sub)
+}
+
+// resume serves POST /me/subscription/resume, undoing a cancel.
+func (h *subscriptionHandler) resume(c echo.Context) error {
+	sub, err := h.subscriptions.Resume(c.Request().Context(), currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sub)
+}
+
+// payments serves GET /me/payments, newest first.
+func (h *subscriptionHandler) payments(c echo.Context) error {
+	req, err := pageRequest(c)
+	if err != nil {
+		return err
+	}
+	page, err := h.subscriptions.Payments(c.Request().Context(), currentUser(c).ID, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/repository"
+	"github.com/labstack/echo/v4"
+)
+
+type userHandler struct {
+	users *repository.UserRepository
+}
+
+// publicUser is what anyone may see of a user: no email, phone, role or
+// account state.
+type publicUser struct {
+	ID          uint          `json:"id"`
+	FirstName   string        `json:"first_name,omitempty"`
+	LastName    string        `json:"last_name,omitempty"`
+	BooksCount  uint          `json:"books_count"`
+	UserProfile publicProfile `json:"user_profile"`
+}
+
+// publicProfile is the display part of a user's profile.
+type publicProfile struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+func newPublicUser(user *models.User) publicUser {
+	return publicUser{
+		ID:         user.ID,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		BooksCount: user.BooksCount,
+		UserProfile: publicProfile{
+			DisplayName: user.UserProfile.DisplayName,
+			Bio:         user.UserProfile.Bio,
+			AvatarURL:   user.UserProfile.AvatarURL,
+		},
+	}
+}
+
+// get serves GET /users/:id, the public fields of the user only.
+func (h *userHandler) get(c echo.Context) error {
+	id, err := pathID(c, "id")
+	if err != nil {
+		return err
+	}
+	user, err := h.users.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newPublicUser(user))
+}
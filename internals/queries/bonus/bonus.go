@@ -1 +1,73 @@
 package bonus
+
+import (
+	"fmt"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/projection"
+	"github.com/Amanuel-0/gorm-pg/internals/util"
+	"gorm.io/gorm"
+)
+
+// ## 🧩 Bonus Challenges
+
+// Implement pagination with cursor-based queries.
+// walks a chat thread newest → oldest, 2 messages at a time, then walks one
+// page back with the prev cursor
+func GetThreadMessagesPaginated(db *gorm.DB) {
+	var threadId uint = 2
+	keys := []pagination.Key{pagination.Desc("created_at")}
+
+	query := func() *gorm.DB {
+		return db.Model(&models.Message{}).
+			Where("thread_id = ?", threadId).
+			Select("id", "thread_id", "sender_id", "type", "body", "created_at")
+	}
+
+	req := pagination.Request{Limit: 2}
+	var last *pagination.Page[models.Message]
+	for {
+		page, err := pagination.Paginate[models.Message](query(), keys, req)
+		if err != nil {
+			fmt.Printf("error paginating thread messages: %v", err)
+			return
+		}
+		util.PrettyPrint(page, "GetThreadMessagesPaginated: page")
+		last = page
+		if page.NextCursor == "" {
+			break
+		}
+		req.After = page.NextCursor
+	}
+
+	if last.PrevCursor == "" {
+		return
+	}
+	prev, err := pagination.Paginate[models.Message](query(), keys, pagination.Request{Limit: 2, Before: last.PrevCursor})
+	if err != nil {
+		fmt.Printf("error paginating thread messages backwards: %v", err)
+		return
+	}
+	util.PrettyPrint(prev, "GetThreadMessagesPaginated: previous page")
+}
+
+// same result as level4.GetCommunityThreads but the Select/Preload column
+// lists are derived from a field spec, the keys (created_by, thread_id,
+// sender_id, user_id) are added automatically
+func GetCommunityThreadsProjected(db *gorm.DB) {
+	const fields = "title,creator(email,first_name,last_name,user_profile(bio,avatar_url)),messages(body,sender(user_profile(bio,avatar_url)))"
+
+	scope, err := projection.Scope(db, &models.CommunityThread{}, fields)
+	if err != nil {
+		fmt.Printf("error building projection: %v", err)
+		return
+	}
+
+	var threads []models.CommunityThread
+	if err := db.Model(&models.CommunityThread{}).Scopes(scope).Find(&threads).Error; err != nil {
+		fmt.Printf("error fetching community threads: %v", err)
+	}
+
+	util.PrettyPrint(threads, "GetCommunityThreadsProjected: method")
+}
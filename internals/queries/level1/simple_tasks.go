@@ -1,7 +1,6 @@
 package level1
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +10,7 @@ import (
 	// "context"
 
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
 	"github.com/Amanuel-0/gorm-pg/internals/util"
 	"gorm.io/gorm"
 )
@@ -74,11 +74,9 @@ func UpdateUser(db *gorm.DB, id uint) {
 
 // Soft delete a user (set `deleted_at`).
 func DeleteUser(db *gorm.DB, id uint) {
-	// db.Where("user_id").Delete(&)
-	ctx := context.Background()
-	affected, err := gorm.G[models.User](db).Where("id = ?", id).Delete(ctx)
-	fmt.Printf("affected: %d", affected)
-	if err != nil {
+	// softdelete cascades to what the user owns (books, their images, ...)
+	// with the same deleted_at, so a softdelete.Restore brings it all back
+	if err := softdelete.Delete[models.User](db, id); err != nil {
 		fmt.Printf("error deleting user: %v", err)
 	}
 }
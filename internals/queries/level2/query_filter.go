@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
 	"github.com/Amanuel-0/gorm-pg/internals/util"
 	"gorm.io/gorm"
@@ -153,17 +154,18 @@ func GetUsersWithBookCount(db *gorm.DB) {
 // Retrieve all books with their review averages.
 func GetBooksWithAvgReview(db *gorm.DB) {
 	type Result struct {
-		BookID    uint    `json:"book_id"`
-		Title     string  `json:"title"`
-		AvgReview float64 `json:"avg_review"`
+		BookID    uint     `json:"book_id"`
+		Title     string   `json:"title"`
+		AvgReview *float64 `json:"avg_review"`
 	}
 	var results []Result
 
-	subQuery := db.Model(&models.BookReview{}).Select("AVG(rating)").Where("book_reviews.book_id = books.id")
-
-	err := db.Model(&models.Book{}).
-		Select("books.id as book_id, books.title, (?) as avg_review", subQuery).
-		Scan(&results).Error
+	// the average is kept on the book (rating_avg), no need to aggregate the
+	// reviews every time
+	err := db.Scopes(cache.Cached(5 * time.Minute)).
+		Model(&models.Book{}).
+		Select("books.id as book_id, books.title, books.rating_avg as avg_review").
+		Find(&results).Error
 
 	if err != nil {
 		fmt.Printf("error fetching books with avg review: %v\n", err)
@@ -1,11 +1,14 @@
 package level3
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
 	"github.com/Amanuel-0/gorm-pg/internals/util"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -29,14 +32,20 @@ func CreateSubscription(db *gorm.DB) {
 
 	// note: a user can only have a single active subscription
 
-	// get the subscription plan to use it to calculate the sub end time
-	var subPlan models.SubscriptionPlan
-	if err := db.Model(&models.SubscriptionPlan{}).Where("id = ?", subPlanId).First(&subPlan).Error; err != nil {
-		fmt.Printf("error getting the selected subscription plan: %v ", err)
-	}
-	// sub plan end date
-	endDate := getSubscriptionEndDate(subPlan)
-	db.Transaction(func(db *gorm.DB) error {
+	ctx := context.Background()
+	tm := txmanager.New(db)
+	err := tm.Do(ctx, func(ctx context.Context) error {
+		db := tm.DB(ctx)
+
+		// get the subscription plan to use it to calculate the sub end time,
+		// read inside the transaction so the price charged is the one we lock in
+		var subPlan models.SubscriptionPlan
+		if err := db.Model(&models.SubscriptionPlan{}).Where("id = ?", subPlanId).First(&subPlan).Error; err != nil {
+			return fmt.Errorf("error getting the selected subscription plan: %w", err)
+		}
+		// sub plan end date
+		endDate := getSubscriptionEndDate(subPlan)
+
 		// Serialize per-user subscription changes to avoid races
 		var user models.User
 		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userId).First(&user).Error; err != nil {
@@ -76,39 +85,41 @@ func CreateSubscription(db *gorm.DB) {
 			return err
 		}
 
+		// only report the subscription once it is actually committed
+		txmanager.AfterCommit(ctx, func(ctx context.Context) {
+			util.PrettyPrint(sub, "CreateSubscription: method")
+		})
+
 		return nil
 	})
-
+	if err != nil {
+		fmt.Printf("error creating subscription: %v", err)
+	}
 }
 
 // - [ ] On book deletion:
-//   - [ ] Soft delete the book (`archived_at`).
-//   - [ ] Cascade delete its images and related `book_genres`.
+//   - [x] Soft delete the book (`deleted_at`).
+//   - [x] Cascade delete its images and related `book_genres`.
 func SoftDelBook(db *gorm.DB) {
 	const id uint = 3
 
-	db.Transaction(func(tx *gorm.DB) error {
-		var book models.Book
-		if err := tx.
-			Preload("Genres").
-			Preload("Images").
-			Where("id = ?", id).
-			First(&book).Error; err != nil {
-			return err
-		}
-
-		// Clear many-to-many relationship manually
-		if err := tx.Model(&book).Association("Genres").Clear(); err != nil {
-			return err
-		}
-
-		// Delete Book (this will also delete Images because of OnDelete:CASCADE)
-		if err := tx.Unscoped().Delete(&book).Error; err != nil {
-			return err
-		}
+	// trashes the book with its images and reviews (deleted_at, not
+	// archived_at which is a listing state), the genre links stay so a
+	// Restore brings the book back as it was; Purge removes them for good
+	if err := softdelete.Delete[models.Book](db, id); err != nil {
+		fmt.Printf("error deleting book: %v", err)
+		return
+	}
 
-		return nil
-	})
+	trashed, err := softdelete.ListTrashed[models.Book](db.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		// the images went to the trash with the book
+		return db.Unscoped()
+	}))
+	if err != nil {
+		fmt.Printf("error listing trashed books: %v", err)
+		return
+	}
+	util.PrettyPrint(trashed, "SoftDelBook: trashed books")
 }
 
 // - [ ] Create a transaction that handles an exchange:
@@ -118,7 +129,11 @@ func SoftDelBook(db *gorm.DB) {
 func CompleteExchange(db *gorm.DB) {
 	const id uint = 3 // previously in 'accepted' state
 
-	db.Transaction(func(db *gorm.DB) error {
+	// deadlocks between concurrent completions are retried by the tx manager
+	ctx := context.Background()
+	tm := txmanager.New(db)
+	err := tm.Do(ctx, func(ctx context.Context) error {
+		db := tm.DB(ctx)
 		var ex models.Exchange
 
 		if err := db.Model(&models.Exchange{}).
@@ -130,7 +145,11 @@ func CompleteExchange(db *gorm.DB) {
 
 		ex.Status = string(models.ExchangeStatusCompleted)
 
-		db.Save(&ex)
+		// no row lock, the save only goes through if ex.Version is still the
+		// current one (optlock), a concurrent transition gets a conflict
+		if err := db.Save(&ex).Error; err != nil {
+			return err
+		}
 
 		// make the books unavailable date set to nil & update the status
 		var rqBookId = ex.RequesterBookID
@@ -138,10 +157,11 @@ func CompleteExchange(db *gorm.DB) {
 		// Update both books as unavailable
 		if err := db.Model(&models.Book{}).
 			Where("id IN ?", []uint{*rqBookId, *rsBookId}).
-			Updates(models.Book{
-				AvailableFrom:  nil,
-				AvailableUntil: nil,
-				Active:         true,
+			// a map, a struct would skip the nil dates, and bumps the versions
+			Updates(map[string]any{
+				"available_from":  nil,
+				"available_until": nil,
+				"active":          true,
 			}).Error; err != nil {
 			return err
 		}
@@ -170,11 +190,15 @@ func CompleteExchange(db *gorm.DB) {
 			return err
 		}
 
-		util.PrettyPrint(ex, "CompleteExchange: method")
+		txmanager.AfterCommit(ctx, func(ctx context.Context) {
+			util.PrettyPrint(ex, "CompleteExchange: method")
+		})
 
 		return nil
 	})
-
+	if err != nil {
+		fmt.Printf("error completing exchange: %v", err)
+	}
 }
 
 // - [ ] Create a function to cancel a subscription:
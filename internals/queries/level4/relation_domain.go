@@ -1,8 +1,12 @@
 package level4
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/archive"
+	"github.com/Amanuel-0/gorm-pg/internals/database/loader"
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
 	"github.com/Amanuel-0/gorm-pg/internals/util"
 	"gorm.io/gorm"
@@ -109,10 +113,11 @@ func GetPaidCommunities(db *gorm.DB) {
 }
 
 // Retrieve all exchanges involving a particular user (as requester or responder).
+// archived exchanges included, see archive.Union
 func GetExchangesOfUser(db *gorm.DB) {
 	var userId uint = 1
 	var exchanges []models.Exchange
-	if err := db.Model(&models.Exchange{}).
+	if err := db.Scopes(archive.Union[models.Exchange]).
 		Preload("Requester", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id", "email", "phone", "first_name", "last_name", "role")
 		}).
@@ -152,3 +157,66 @@ func GetBooksOfUserInCompletedExchanges(db *gorm.DB) {
 
 	util.PrettyPrint(books, "GetBooksOfUserInCompletedExchanges: method")
 }
+
+// Resolve the requester, responder, shipping payer and books of the latest
+// exchanges one by one, as per-field resolvers would; the loaders turn that
+// into one users query and one books query.
+func GetExchangeParticipants(db *gorm.DB) {
+	type Participants struct {
+		ExchangeID    uint         `json:"exchange_id"`
+		Requester     *models.User `json:"requester"`
+		Responder     *models.User `json:"responder,omitempty"`
+		ShippingPayer *models.User `json:"shipping_payer,omitempty"`
+		RequesterBook *models.Book `json:"requester_book,omitempty"`
+		ResponderBook *models.Book `json:"responder_book,omitempty"`
+	}
+
+	ctx := context.Background()
+	var exchanges []models.Exchange
+	if err := db.WithContext(ctx).Order("id DESC").Limit(10).Find(&exchanges).Error; err != nil {
+		fmt.Printf("error fetching exchanges: %v", err)
+		return
+	}
+
+	loaders := loader.New(db.WithContext(ctx))
+	user := func(id *uint) *models.User {
+		if id == nil || *id == 0 {
+			return nil
+		}
+		u, err := loaders.Users.Load(ctx, *id)
+		if err != nil {
+			fmt.Printf("error loading user %d: %v\n", *id, err)
+		}
+		return u
+	}
+	book := func(id *uint) *models.Book {
+		if id == nil {
+			return nil
+		}
+		b, err := loaders.Books.Load(ctx, *id)
+		if err != nil {
+			fmt.Printf("error loading book %d: %v\n", *id, err)
+		}
+		return b
+	}
+
+	results := make([]Participants, len(exchanges))
+	var wg sync.WaitGroup
+	for i, ex := range exchanges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Participants{
+				ExchangeID:    ex.ID,
+				Requester:     user(&ex.RequesterID),
+				Responder:     user(ex.ResponderID),
+				ShippingPayer: user(&ex.ShippingPayerUserID),
+				RequesterBook: book(ex.RequesterBookID),
+				ResponderBook: book(ex.ResponderBookID),
+			}
+		}()
+	}
+	wg.Wait()
+
+	util.PrettyPrint(results, "GetExchangeParticipants: method")
+}
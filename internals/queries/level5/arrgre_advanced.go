@@ -2,7 +2,9 @@ package level5
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/Amanuel-0/gorm-pg/internals/database/cache"
 	"github.com/Amanuel-0/gorm-pg/internals/database/models"
 	"github.com/Amanuel-0/gorm-pg/internals/util"
 	"gorm.io/gorm"
@@ -35,6 +37,20 @@ func GetTop5UsersByBooksOwned(db *gorm.DB) {
 	fmt.Println("\nuser count: ", len(users))
 }
 
+// Same as GetTop5UsersByBooksOwned, from the books_count kept by the counter
+// plugin instead of a join and group by.
+func GetTop5UsersByBooksCount(db *gorm.DB) {
+	var users []models.User
+	if err := db.Model(&models.User{}).
+		Order("books_count DESC").
+		Limit(5).
+		Find(&users).Error; err != nil {
+		fmt.Printf("error fetching top 5 book owner users: %v", err)
+	}
+
+	util.PrettyPrint(users, "GetTop5UsersByBooksCount: method")
+}
+
 // Find authors with the most books listed.
 func AuthorsWithMostBookListed(db *gorm.DB) {
 	type Result struct {
@@ -78,19 +94,10 @@ func GetAvgUserRating(db *gorm.DB) {
 
 // List books with more than or equal to 2 reviews and an average rating > 4.
 func GetBooksWithCondReviewAndRaring(db *gorm.DB) {
-	type Result struct {
-		models.Book
-		TotalReviews float64 `json:"total_review"`
-		AvgRating    float64 `json:"avg_rating"`
-	}
-
-	// var books []models.Book
-	var books []Result
+	// the review count and average are kept on the book, see counter
+	var books []models.Book
 	result := db.Model(&models.Book{}).
-		Joins("JOIN book_reviews br ON br.book_id = books.id").
-		Select("books.*, COUNT(br.id) AS total_reviews, AVG(br.rating) AS avg_rating").
-		Group("books.id").
-		Having("total_reviews >= ? AND avg_rating > ?", 2, 4).
+		Where("reviews_count >= ? AND rating_avg > ?", 2, 4).
 		Order("books.id DESC").
 		Preload("BookReviews", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id", "book_id", "reviewer_id", "rating", "comment")
@@ -101,6 +108,23 @@ func GetBooksWithCondReviewAndRaring(db *gorm.DB) {
 	fmt.Println("\ncount: ", result.RowsAffected)
 }
 
+// Rank books by their Bayesian rating score, a book with a single 5 star
+// review doesn't outrank one with a hundred 4.8s.
+func GetTopRatedBooks(db *gorm.DB) {
+	var books []models.Book
+	result := db.Model(&models.Book{}).
+		Select("id", "owner_id", "title", "reviews_count", "rating_avg", "rating_score").
+		Order("rating_score DESC").
+		Order("reviews_count DESC").
+		Limit(10).
+		Find(&books)
+	if result.Error != nil {
+		fmt.Printf("error fetching top rated books: %v", result.Error)
+	}
+
+	util.PrettyPrint(books, "GetTopRatedBooks: method")
+}
+
 // Count the number of messages sent per user per month.
 func ListUsersMessageStatsByMonth(db *gorm.DB) {
 	type Result struct {
@@ -176,7 +200,8 @@ func SubscriptionPlansRankedByActiveSubCount(db *gorm.DB) {
 		SubCount uint `json:"sub_count"`
 	}
 	var results []Result
-	r := db.Model(&models.SubscriptionPlan{}).
+	r := db.Scopes(cache.Cached(5*time.Minute, "subscriptions")).
+		Model(&models.SubscriptionPlan{}).
 		// Select("subscription_plans.*, COUNT(s.id) AS sub_count").
 		Select(`
 			subscription_plans.id,
@@ -191,7 +216,7 @@ func SubscriptionPlansRankedByActiveSubCount(db *gorm.DB) {
 		Joins("LEFT JOIN subscriptions s ON s.plan_id = subscription_plans.id AND s.status = ?", models.SubscriptionStatusActive). // filter active subs here
 		Group("subscription_plans.id").
 		Order("sub_count DESC").
-		Scan(&results)
+		Find(&results)
 
 	if r.Error != nil {
 		fmt.Printf("error fetching ranked sub plan: %v", r.Error)
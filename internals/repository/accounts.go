@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm/clause"
+)
+
+// SessionObject is the activity log object type of sessions. A successful
+// login is logged as a session, its id being the session's; the logout
+// ending it points at it.
+const SessionObject = "session"
+
+// AccountRepository is the data access of registration, login and logout.
+type AccountRepository struct {
+	tm *txmanager.Manager
+}
+
+// Register creates user and its profile together, a *dberrors.ErrDuplicate
+// when the email or phone is taken.
+func (r *AccountRepository) Register(ctx context.Context, user *models.User, profile *models.UserProfile) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if err := db.Omit(clause.Associations).Create(user).Error; err != nil {
+			return err
+		}
+		profile.UserID = user.ID
+		if err := db.Omit(clause.Associations).Create(profile).Error; err != nil {
+			return err
+		}
+		user.UserProfile = *profile
+		return nil
+	})
+}
+
+// ByLogin returns the user whose column (email or phone) is login.
+func (r *AccountRepository) ByLogin(ctx context.Context, column, login string) (*models.User, error) {
+	var user models.User
+	if err := r.tm.DB(ctx).Where(clause.Eq{Column: clause.Column{Name: column}, Value: login}).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// StartSession logs the login of user as a session, the id of login being
+// the session's, rehashed replacing its password hash when not empty.
+func (r *AccountRepository) StartSession(ctx context.Context, user *models.User, rehashed string, login *models.ActivityLog) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if rehashed != "" {
+			if err := db.Model(user).Update("password_hash", rehashed).Error; err != nil {
+				return err
+			}
+		}
+		login.UserID = &user.ID
+		login.Action = models.LogActionLogin
+		login.ObjectType = SessionObject
+		return db.Omit(clause.Associations).Create(login).Error
+	})
+}
+
+// SessionUser returns the user of the session with sessionID, a
+// *dberrors.ErrNotFound once the session was logged out.
+func (r *AccountRepository) SessionUser(ctx context.Context, userID, sessionID uint) (*models.User, error) {
+	db := r.tm.DB(ctx)
+	session := db.Model(&models.ActivityLog{}).Select("1").
+		Where("id = ? AND user_id = ? AND action = ? AND object_type = ?", sessionID, userID, models.LogActionLogin, SessionObject)
+	logout := db.Model(&models.ActivityLog{}).Select("1").
+		Where("object_type = ? AND object_id = ? AND action = ?", SessionObject, sessionID, models.LogActionLogout)
+
+	var user models.User
+	if err := db.Where("EXISTS (?) AND NOT EXISTS (?)", session, logout).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// EndSession logs the logout of the session with sessionID of userID.
+func (r *AccountRepository) EndSession(ctx context.Context, userID, sessionID uint, logout *models.ActivityLog) error {
+	logout.UserID = &userID
+	logout.Action = models.LogActionLogout
+	logout.ObjectType = SessionObject
+	logout.ObjectID = &sessionID
+	return r.tm.DB(ctx).Omit(clause.Associations).Create(logout).Error
+}
+
+// LogAttempt logs a failed login, its UserID set when the account exists.
+func (r *AccountRepository) LogAttempt(ctx context.Context, attempt *models.ActivityLog) error {
+	attempt.Action = models.LogActionLogin
+	return r.tm.DB(ctx).Omit(clause.Associations).Create(attempt).Error
+}
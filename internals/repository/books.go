@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"net/url"
+	"strings"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/filter"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BookRepository struct {
+	tm *txmanager.Manager
+}
+
+// embedded preloads what a book comes with in lists and on its own: its
+// author, genres and primary image.
+func embedded(db *gorm.DB) *gorm.DB {
+	return db.Preload("Author").
+		Preload("Genres").
+		Preload("Images", "is_primary = ?", true)
+}
+
+// List returns a page of books filtered and sorted by q, see
+// models.Book.FilterSpec, newest first unless q sorts. On top of the spec q
+// can have
+//
+//	genre=fantasy,history   books in any of these genres (slugs)
+//	available_on=2025-10-01 books available on that day
+//
+// Only active books are listed unless q filters on active itself.
+func (r *BookRepository) List(ctx context.Context, q url.Values, req pagination.Request) (*pagination.Page[models.Book], error) {
+	spec := models.Book{}.FilterSpec()
+	q = maps.Clone(q)
+	db := r.tm.DB(ctx).Model(&models.Book{}).Scopes(embedded)
+
+	if genres := q.Get("genre"); genres != "" {
+		slugs := strings.Split(genres, ",")
+		db = db.Where("books.id IN (?)", r.tm.DB(ctx).Table("book_genres").
+			Select("book_genres.book_id").
+			Joins("JOIN genres ON genres.id = book_genres.genre_id AND genres.deleted_at IS NULL").
+			Where("genres.slug IN ?", slugs))
+	}
+	if day := q.Get("available_on"); day != "" {
+		on, err := filter.Time(day)
+		if err != nil {
+			return nil, &filter.Error{Param: "available_on", Reason: err.Error()}
+		}
+		db = db.Where("(books.available_from IS NULL OR books.available_from <= ?) AND (books.available_until IS NULL OR books.available_until >= ?)", on, on)
+	}
+	q.Del("genre")
+	q.Del("available_on")
+	if !q.Has("active") {
+		db = db.Where("books.active = ?", true)
+	}
+
+	where, err := spec.Where(q)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := spec.SortKeys(q, pagination.Desc("created_at"))
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Paginate[models.Book](db.Scopes(where), keys, req)
+}
+
+// Get returns the book with id, with its author, genres and primary image.
+func (r *BookRepository) Get(ctx context.Context, id uint) (*models.Book, error) {
+	var book models.Book
+	if err := r.tm.DB(ctx).Scopes(embedded).First(&book, id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// Create inserts book in the genres with genreIDs.
+func (r *BookRepository) Create(ctx context.Context, book *models.Book, genreIDs []uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		// gorm writes the column default, true, in place of a false on
+		// create, into book too
+		active := book.Active
+		if err := db.Omit(clause.Associations).Create(book).Error; err != nil {
+			return err
+		}
+		if !active {
+			// through the table, not the model, so optlock leaves the
+			// version at 1
+			if err := db.Table("books").Where("id = ?", book.ID).Update("active", false).Error; err != nil {
+				return err
+			}
+			book.Active = false
+		}
+		return r.setGenres(ctx, book.ID, genreIDs)
+	})
+}
+
+// Update saves book, a book loaded by Get, failing with
+// *dberrors.ErrConflict when it changed since. A non nil genreIDs replaces
+// its genres.
+func (r *BookRepository) Update(ctx context.Context, book *models.Book, genreIDs []uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		if err := r.tm.DB(ctx).Omit(clause.Associations).Save(book).Error; err != nil {
+			return err
+		}
+		if genreIDs == nil {
+			return nil
+		}
+		if err := r.tm.DB(ctx).Table("book_genres").Where("book_id = ?", book.ID).Delete(nil).Error; err != nil {
+			return err
+		}
+		return r.setGenres(ctx, book.ID, genreIDs)
+	})
+}
+
+// setGenres links a book to genres, an unknown genre is a foreign key error.
+func (r *BookRepository) setGenres(ctx context.Context, bookID uint, genreIDs []uint) error {
+	if len(genreIDs) == 0 {
+		return nil
+	}
+	links := make([]map[string]any, len(genreIDs))
+	for i, id := range genreIDs {
+		links[i] = map[string]any{"book_id": bookID, "genre_id": id}
+	}
+	return r.tm.DB(ctx).Table("book_genres").Clauses(clause.OnConflict{DoNothing: true}).Create(links).Error
+}
+
+// Delete moves the book with id, its images and reviews to the trash.
+func (r *BookRepository) Delete(ctx context.Context, id uint) error {
+	return softdelete.Delete[models.Book](r.tm.DB(ctx), id)
+}
+
+// Images returns the images of a book, the primary one first.
+func (r *BookRepository) Images(ctx context.Context, bookID uint) ([]models.BookImage, error) {
+	var images []models.BookImage
+	err := r.tm.DB(ctx).Where("book_id = ?", bookID).
+		Order("is_primary DESC").Order("id").
+		Find(&images).Error
+	return images, err
+}
+
+// AddImage adds an image to its book. A primary image takes over from the
+// current one, the first image of a book is always primary.
+func (r *BookRepository) AddImage(ctx context.Context, image *models.BookImage) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		// lock the book, two images can't both become primary
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&models.Book{}, image.BookID).Error; err != nil {
+			return err
+		}
+		if image.IsPrimary {
+			if err := db.Model(&models.BookImage{}).
+				Where("book_id = ? AND is_primary = ?", image.BookID, true).
+				Update("is_primary", false).Error; err != nil {
+				return err
+			}
+		} else {
+			var count int64
+			if err := db.Model(&models.BookImage{}).Where("book_id = ?", image.BookID).Count(&count).Error; err != nil {
+				return err
+			}
+			image.IsPrimary = count == 0
+		}
+		return db.Create(image).Error
+	})
+}
+
+// DeleteImage deletes an image of a book. When it was the primary one the
+// oldest remaining image becomes primary.
+func (r *BookRepository) DeleteImage(ctx context.Context, bookID, imageID uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var image models.BookImage
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("book_id = ?", bookID).First(&image, imageID).Error; err != nil {
+			return err
+		}
+		if err := db.Delete(&image).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+		var next models.BookImage
+		err := db.Where("book_id = ?", bookID).Order("id").Limit(1).Find(&next).Error
+		if err != nil || next.ID == 0 {
+			return err
+		}
+		return db.Model(&next).Update("is_primary", true).Error
+	})
+}
+
+// Reviews returns a page of the reviews of a book, newest first, with their
+// reviewer's name.
+func (r *BookRepository) Reviews(ctx context.Context, bookID uint, req pagination.Request) (*pagination.Page[models.BookReview], error) {
+	db := r.tm.DB(ctx).Where("book_id = ?", bookID).
+		Preload("User", func(db *gorm.DB) *gorm.DB { return db.Select("id", "first_name", "last_name") })
+	return pagination.Paginate[models.BookReview](db, []pagination.Key{pagination.Desc("created_at")}, req)
+}
+
+// Reviewed tells whether reviewerID has a live review of the book.
+func (r *BookRepository) Reviewed(ctx context.Context, bookID, reviewerID uint) (bool, error) {
+	var count int64
+	err := r.tm.DB(ctx).Model(&models.BookReview{}).
+		Where("book_id = ? AND reviewer_id = ?", bookID, reviewerID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetReview returns a review of a book.
+func (r *BookRepository) GetReview(ctx context.Context, bookID, reviewID uint) (*models.BookReview, error) {
+	var review models.BookReview
+	if err := r.tm.DB(ctx).Where("book_id = ?", bookID).First(&review, reviewID).Error; err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// AddReview inserts a review, the book's counters follow (see counter).
+func (r *BookRepository) AddReview(ctx context.Context, review *models.BookReview) error {
+	return r.tm.DB(ctx).Omit(clause.Associations).Create(review).Error
+}
+
+// DeleteReview moves a review to the trash.
+func (r *BookRepository) DeleteReview(ctx context.Context, review *models.BookReview) error {
+	return r.tm.DB(ctx).Delete(review).Error
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm/clause"
+)
+
+// ChatRepository is the chat of an exchange's participants: one thread per
+// exchange, opened by whoever chats first. Only the requester and the
+// responder get in, an archived thread can be read but not written to.
+type ChatRepository struct {
+	tm *txmanager.Manager
+}
+
+// Thread returns the chat thread of the exchange with exchangeID for userID,
+// with the exchange's participants, creating it when the exchange has none
+// yet.
+func (r *ChatRepository) Thread(ctx context.Context, exchangeID, userID uint) (*models.ChatThread, error) {
+	var thread models.ChatThread
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var ex models.Exchange
+		if err := db.Select("id", "requester_id", "responder_id").First(&ex, exchangeID).Error; err != nil {
+			return err
+		}
+		if !participant(&ex, userID) {
+			return &ForbiddenError{Reason: "you don't take part in this exchange"}
+		}
+
+		err := db.Where("exchange_id = ?", ex.ID).Order("id").First(&thread).Error
+		var notFound *dberrors.ErrNotFound
+		if !errors.As(err, &notFound) {
+			thread.Exchange = &ex
+			return err
+		}
+		// both participants may open it at once, the exchange row lock lets
+		// the second one find the first's thread
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Exchange{}, ex.ID).Error; err != nil {
+			return err
+		}
+		err = db.Where("exchange_id = ?", ex.ID).Order("id").First(&thread).Error
+		if errors.As(err, &notFound) {
+			thread = models.ChatThread{ExchangeID: ex.ID, CreatedBy: userID}
+			err = db.Omit(clause.Associations).Create(&thread).Error
+		}
+		thread.Exchange = &ex
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// participant tells whether userID is the requester or the responder of ex.
+func participant(ex *models.Exchange, userID uint) bool {
+	return ex.RequesterID == userID || ex.ResponderID != nil && *ex.ResponderID == userID
+}
+
+// Since returns up to limit messages of threadID after the one with afterID,
+// oldest first: what a client reconnecting missed.
+func (r *ChatRepository) Since(ctx context.Context, threadID, afterID uint, limit int) ([]models.Message, error) {
+	var msgs []models.Message
+	if err := r.tm.DB(ctx).Where("thread_id = ? AND id > ?", threadID, afterID).Order("id").Limit(limit).Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Send stores msg in thread and tells whether it did: a message whose
+// ClientID its sender already used isn't stored again, msg is then the
+// stored one.
+func (r *ChatRepository) Send(ctx context.Context, thread *models.ChatThread, msg *models.Message) (bool, error) {
+	if thread.Archived {
+		return false, &StateError{Entity: "ChatThread", ID: thread.ID, Status: "archived", Action: "post in"}
+	}
+	msg.ThreadID = thread.ID
+	if msg.Attachments == "" {
+		msg.Attachments = "[]"
+	}
+	stored := false
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if msg.ClientID != nil {
+			var sent models.Message
+			err := db.Where("sender_id = ? AND client_id = ?", msg.SenderID, *msg.ClientID).First(&sent).Error
+			var notFound *dberrors.ErrNotFound
+			switch {
+			case err == nil && sent.ThreadID == msg.ThreadID:
+				*msg = sent
+				return nil
+			case err == nil:
+				return &ForbiddenError{Reason: "client_id is already used by a message of another thread"}
+			case !errors.As(err, &notFound):
+				return err
+			}
+		}
+		if err := db.Omit(clause.Associations).Create(msg).Error; err != nil {
+			return err
+		}
+		stored = true
+		return nil
+	})
+	return stored, err
+}
+
+// MarkDelivered marks the messages of threadID up to the one with upToID
+// delivered to userID, those the other participant sent and that weren't
+// yet. It returns the time it set, nil when there was nothing to mark.
+func (r *ChatRepository) MarkDelivered(ctx context.Context, threadID, userID, upToID uint) (*time.Time, error) {
+	now := time.Now()
+	res := r.tm.DB(ctx).Model(&models.Message{}).
+		Where("thread_id = ? AND sender_id <> ? AND id <= ? AND delivered_at IS NULL", threadID, userID, upToID).
+		Update("delivered_at", now)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &now, nil
+}
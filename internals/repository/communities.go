@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Communities are open: anyone can browse them and read their threads, only
+// members post. Roles come from CommunityMember.CommunityRole:
+//
+//	member     creates threads, posts and removes their own messages
+//	moderator  also pins threads, removes any message and removes members
+//	admin      also changes roles and removes moderators
+//
+// The creator of a community is its first admin, and the last admin can't
+// leave while anybody else is still in it.
+type CommunityRepository struct {
+	tm *txmanager.Manager
+}
+
+// staff are the roles moderating a community.
+var staff = []models.CommunityRole{models.CommunityRoleAdmin, models.CommunityRoleModerator}
+
+// senderName preloads the id and names of a user relation.
+func senderName(db *gorm.DB) *gorm.DB { return db.Select("id", "first_name", "last_name") }
+
+// List returns a page of communities with their creators' names, filtered
+// and sorted by q, see models.Community.FilterSpec, the biggest first unless
+// q sorts.
+func (r *CommunityRepository) List(ctx context.Context, q url.Values, req pagination.Request) (*pagination.Page[models.Community], error) {
+	spec := models.Community{}.FilterSpec()
+	where, err := spec.Where(q)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := spec.SortKeys(q, pagination.Desc("members_count"))
+	if err != nil {
+		return nil, err
+	}
+	db := r.tm.DB(ctx).Model(&models.Community{}).Preload("Creator", senderName)
+	return pagination.Paginate[models.Community](db.Scopes(where), keys, req)
+}
+
+// GetBySlug returns the community with slug and the name of its creator.
+func (r *CommunityRepository) GetBySlug(ctx context.Context, slug string) (*models.Community, error) {
+	var c models.Community
+	if err := r.tm.DB(ctx).Preload("Creator", senderName).Where("slug = ?", slug).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Create creates the community with its creator as admin.
+func (r *CommunityRepository) Create(ctx context.Context, c *models.Community) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		// gorm writes the column default, true, in place of a false on
+		// create, into c too
+		paid := c.RequirePaidChat
+		if err := db.Omit(clause.Associations).Create(c).Error; err != nil {
+			return err
+		}
+		if !paid {
+			if err := db.Model(c).Update("require_paid_chat", false).Error; err != nil {
+				return err
+			}
+		}
+		return db.Create(&models.CommunityMember{
+			CommunityID:   c.ID,
+			UserID:        c.CreatorID,
+			CommunityRole: models.CommunityRoleAdmin,
+		}).Error
+	})
+}
+
+// Member returns the membership of userID in the community, a
+// *dberrors.ErrNotFound when they aren't in it.
+func (r *CommunityRepository) Member(ctx context.Context, communityID, userID uint) (*models.CommunityMember, error) {
+	return r.member(r.tm.DB(ctx), communityID, userID)
+}
+
+// Members returns a page of the members of the community with their names,
+// in the order they joined, only those with role unless it is empty.
+func (r *CommunityRepository) Members(ctx context.Context, communityID uint, role models.CommunityRole, req pagination.Request) (*pagination.Page[models.CommunityMember], error) {
+	db := r.tm.DB(ctx).Model(&models.CommunityMember{}).
+		Preload("User", senderName).
+		Where("community_id = ?", communityID)
+	if role != "" {
+		db = db.Where("community_role = ?", role)
+	}
+	return pagination.Paginate[models.CommunityMember](db, []pagination.Key{pagination.Asc("joined_at")}, req)
+}
+
+// Join adds userID to the community as a plain member. Someone who left and
+// comes back gets their old membership back, with a fresh joined_at.
+func (r *CommunityRepository) Join(ctx context.Context, communityID, userID uint) (*models.CommunityMember, error) {
+	var m models.CommunityMember
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		err := db.Unscoped().Where("community_id = ? AND user_id = ?", communityID, userID).First(&m).Error
+		var notFound *dberrors.ErrNotFound
+		switch {
+		case errors.As(err, &notFound):
+			m = models.CommunityMember{CommunityID: communityID, UserID: userID, CommunityRole: models.CommunityRoleMember}
+			return db.Create(&m).Error
+		case err != nil:
+			return err
+		case !m.DeletedAt.Valid:
+			return &StateError{Entity: "Community", ID: communityID, Status: "already joined", Action: "join"}
+		}
+
+		// the unique index on (community_id, user_id) covers trashed rows
+		if err := softdelete.Restore[models.CommunityMember](db, m.ID); err != nil {
+			return err
+		}
+		return db.Model(&m).Updates(map[string]any{
+			"community_role": models.CommunityRoleMember,
+			"joined_at":      time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Member(ctx, communityID, userID)
+}
+
+// Leave takes userID out of the community.
+func (r *CommunityRepository) Leave(ctx context.Context, communityID, userID uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if err := lockCommunity(db, communityID); err != nil {
+			return err
+		}
+		m, err := r.member(db, communityID, userID)
+		if err != nil {
+			return err
+		}
+		if m.CommunityRole == models.CommunityRoleAdmin {
+			if err := r.keepAdmin(db, m); err != nil {
+				return err
+			}
+		}
+		return softdelete.Delete[models.CommunityMember](db, m.ID)
+	})
+}
+
+// lockCommunity locks the row of the community with id until the
+// transaction of db ends. Leaving and role changes take it first, before
+// reading any member: two admins leaving at once would otherwise both see
+// the other one still there.
+func lockCommunity(db *gorm.DB, id uint) error {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Community{}, id).Error
+}
+
+// keepAdmin refuses to let the last admin of a community with other members
+// go, under the lock of lockCommunity.
+func (r *CommunityRepository) keepAdmin(db *gorm.DB, m *models.CommunityMember) error {
+	others := db.Model(&models.CommunityMember{}).Where("community_id = ? AND id <> ?", m.CommunityID, m.ID).Session(&gorm.Session{})
+	var members, admins int64
+	if err := others.Count(&members).Error; err != nil {
+		return err
+	}
+	if err := others.Where("community_role = ?", models.CommunityRoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if members > 0 && admins == 0 {
+		return &ForbiddenError{Reason: "the last admin can't leave, make another member admin first"}
+	}
+	return nil
+}
+
+// SetRole gives userID role in the community, admins only. Admins can't
+// change their own role, another admin has to.
+func (r *CommunityRepository) SetRole(ctx context.Context, communityID, actorID, userID uint, role models.CommunityRole) (*models.CommunityMember, error) {
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		// an admin demoted while the other one leaves leaves no admin
+		if err := lockCommunity(db, communityID); err != nil {
+			return err
+		}
+		if _, err := r.require(db, communityID, actorID, "change roles", models.CommunityRoleAdmin); err != nil {
+			return err
+		}
+		if actorID == userID {
+			return &ForbiddenError{Reason: "admins can't change their own role"}
+		}
+		m, err := r.member(db, communityID, userID)
+		if err != nil {
+			return err
+		}
+		return db.Model(m).Update("community_role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Member(ctx, communityID, userID)
+}
+
+// RemoveMember takes userID out of the community on behalf of actorID.
+// Moderators remove plain members, admins moderators too; admins are only
+// removed by leaving.
+func (r *CommunityRepository) RemoveMember(ctx context.Context, communityID, actorID, userID uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		actor, err := r.require(db, communityID, actorID, "remove members", staff...)
+		if err != nil {
+			return err
+		}
+		if actorID == userID {
+			return &ForbiddenError{Reason: "leave the community instead of removing yourself"}
+		}
+		m, err := r.member(db, communityID, userID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.CommunityRole == models.CommunityRoleAdmin:
+			return &ForbiddenError{Reason: "admins can't be removed"}
+		case m.CommunityRole == models.CommunityRoleModerator && actor.CommunityRole != models.CommunityRoleAdmin:
+			return &ForbiddenError{Reason: "only admins can remove moderators"}
+		}
+		return softdelete.Delete[models.CommunityMember](db, m.ID)
+	})
+}
+
+// Threads returns a page of the threads of the community, pinned ones
+// first, then the newest.
+func (r *CommunityRepository) Threads(ctx context.Context, communityID uint, req pagination.Request) (*pagination.Page[models.CommunityThread], error) {
+	db := r.tm.DB(ctx).Model(&models.CommunityThread{}).
+		Preload("Creator", senderName).
+		Where("community_id = ?", communityID)
+	return pagination.Paginate[models.CommunityThread](db, []pagination.Key{pagination.Desc("pinned"), pagination.Desc("created_at")}, req)
+}
+
+// GetThread returns the thread with id of the community.
+func (r *CommunityRepository) GetThread(ctx context.Context, communityID, id uint) (*models.CommunityThread, error) {
+	var t models.CommunityThread
+	if err := r.tm.DB(ctx).Preload("Creator", senderName).
+		Where("community_id = ?", communityID).
+		First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateThread creates a thread, its creator has to be a member.
+func (r *CommunityRepository) CreateThread(ctx context.Context, t *models.CommunityThread) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if _, err := r.require(db, t.CommunityID, t.CreatedBy, "start threads"); err != nil {
+			return err
+		}
+		return db.Omit(clause.Associations).Create(t).Error
+	})
+}
+
+// Pin pins or unpins a thread, admins and moderators only.
+func (r *CommunityRepository) Pin(ctx context.Context, communityID, threadID, actorID uint, pinned bool) (*models.CommunityThread, error) {
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if _, err := r.require(db, communityID, actorID, "pin threads", staff...); err != nil {
+			return err
+		}
+		var t models.CommunityThread
+		if err := db.Where("community_id = ?", communityID).First(&t, threadID).Error; err != nil {
+			return err
+		}
+		var at *time.Time
+		if pinned {
+			now := time.Now()
+			at = &now
+		}
+		return db.Model(&t).Updates(map[string]any{"pinned": pinned, "pinned_at": at}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetThread(ctx, communityID, threadID)
+}
+
+// Messages returns a page of the messages of the thread with their senders'
+// names, newest first.
+func (r *CommunityRepository) Messages(ctx context.Context, threadID uint, req pagination.Request) (*pagination.Page[models.CommunityMessage], error) {
+	db := r.tm.DB(ctx).Model(&models.CommunityMessage{}).
+		Preload("Sender", senderName).
+		Where("thread_id = ?", threadID)
+	return pagination.Paginate[models.CommunityMessage](db, []pagination.Key{pagination.Desc("created_at")}, req)
+}
+
+// PostMessage posts a message to a thread of the community, members only.
+func (r *CommunityRepository) PostMessage(ctx context.Context, communityID uint, msg *models.CommunityMessage) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if _, err := r.require(db, communityID, msg.SenderID, "post"); err != nil {
+			return err
+		}
+		return db.Omit(clause.Associations).Create(msg).Error
+	})
+}
+
+// RemoveMessage removes a message of the thread on behalf of actorID, its
+// sender or a moderator of the community.
+func (r *CommunityRepository) RemoveMessage(ctx context.Context, communityID, threadID, messageID, actorID uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var msg models.CommunityMessage
+		if err := db.Where("thread_id = ?", threadID).First(&msg, messageID).Error; err != nil {
+			return err
+		}
+		if msg.SenderID != actorID {
+			if _, err := r.require(db, communityID, actorID, "remove other people's messages", staff...); err != nil {
+				return err
+			}
+		}
+		return softdelete.Delete[models.CommunityMessage](db, msg.ID)
+	})
+}
+
+// member returns the live membership of userID in the community.
+func (r *CommunityRepository) member(db *gorm.DB, communityID, userID uint) (*models.CommunityMember, error) {
+	var m models.CommunityMember
+	if err := db.Where("community_id = ? AND user_id = ?", communityID, userID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// require returns the membership of userID in the community, a
+// *ForbiddenError unless they are in it with one of roles (any role when
+// roles is empty). action says what they tried, for the error.
+func (r *CommunityRepository) require(db *gorm.DB, communityID, userID uint, action string, roles ...models.CommunityRole) (*models.CommunityMember, error) {
+	m, err := r.member(db, communityID, userID)
+	var notFound *dberrors.ErrNotFound
+	switch {
+	case errors.As(err, &notFound):
+		return nil, &ForbiddenError{Reason: "only members can " + action}
+	case err != nil:
+		return nil, err
+	case len(roles) > 0 && !slices.Contains(roles, m.CommunityRole):
+		if slices.Equal(roles, staff) {
+			return nil, &ForbiddenError{Reason: "only admins and moderators can " + action}
+		}
+		return nil, &ForbiddenError{Reason: "only admins can " + action}
+	}
+	return m, nil
+}
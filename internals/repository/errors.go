@@ -0,0 +1,25 @@
+package repository
+
+import "fmt"
+
+// ForbiddenError is returned when a user tries something their part in the
+// record doesn't allow, e.g. a requester accepting their own exchange.
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string { return e.Reason }
+
+// StateError is returned when a record isn't in a state the action can be
+// taken from, e.g. shipping a declined exchange.
+type StateError struct {
+	// Entity is the model name, e.g. Exchange.
+	Entity string
+	ID     uint
+	Status string
+	Action string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("can't %s %s %d, it is %s", e.Action, e.Entity, e.ID, e.Status)
+}
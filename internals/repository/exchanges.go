@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The exchange workflow:
+//
+//	requested -> accepted -> shipped -> delivered -> completed
+//	          -> declined            \-> disputed <-/
+//	          -> canceled (requested or accepted)
+//
+// An exchange without shipping goes from accepted to delivered. Every step
+// notifies the other participant. Steps load the exchange and save it back
+// under its optlock version, two participants acting at once get a
+// *dberrors.ErrConflict instead of one step overwriting the other.
+type ExchangeRepository struct {
+	tm *txmanager.Manager
+}
+
+// ExchangeRequest is what a user asks for when requesting an exchange.
+type ExchangeRequest struct {
+	RequesterID uint
+	// ResponderBookID is the book asked for, its owner is the responder.
+	ResponderBookID uint
+	// RequesterBookID is the book offered in return, if any.
+	RequesterBookID  *uint
+	ShippingRequired bool
+	AgreedStartDate  *time.Time
+	AgreedEndDate    *time.Time
+}
+
+// withParticipants preloads the names of both participants and both books.
+func withParticipants(db *gorm.DB) *gorm.DB {
+	name := func(db *gorm.DB) *gorm.DB { return db.Select("id", "first_name", "last_name") }
+	return db.Preload("Requester", name).
+		Preload("Responder", name).
+		Preload("RequesterBook").
+		Preload("ResponderBook")
+}
+
+// List returns a page of the exchanges userID takes part in, filtered and
+// sorted by q (see models.Exchange.FilterSpec), most recent requests first
+// unless q sorts.
+func (r *ExchangeRepository) List(ctx context.Context, userID uint, q url.Values, req pagination.Request) (*pagination.Page[models.Exchange], error) {
+	spec := models.Exchange{}.FilterSpec()
+	where, err := spec.Where(q)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := spec.SortKeys(q, pagination.Desc("requested_at"))
+	if err != nil {
+		return nil, err
+	}
+	db := r.tm.DB(ctx).Model(&models.Exchange{}).
+		Where("requester_id = ? OR responder_id = ?", userID, userID).
+		Scopes(where, withParticipants)
+	return pagination.Paginate[models.Exchange](db, keys, req)
+}
+
+// Get returns the exchange with id, with its participants and books.
+func (r *ExchangeRepository) Get(ctx context.Context, id uint) (*models.Exchange, error) {
+	var ex models.Exchange
+	if err := r.tm.DB(ctx).Scopes(withParticipants).First(&ex, id).Error; err != nil {
+		return nil, err
+	}
+	return &ex, nil
+}
+
+// Request creates an exchange for the book asked for and notifies its
+// owner. A user can't ask for their own book, offer someone else's, or ask
+// for a book again while their earlier request for it is still open.
+func (r *ExchangeRepository) Request(ctx context.Context, req ExchangeRequest) (*models.Exchange, error) {
+	var ex *models.Exchange
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+
+		var wanted models.Book
+		if err := db.First(&wanted, req.ResponderBookID).Error; err != nil {
+			return err
+		}
+		switch {
+		case wanted.OwnerID == req.RequesterID:
+			return &ForbiddenError{Reason: "you can't request your own book"}
+		case !wanted.Active:
+			return &StateError{Entity: "Book", ID: wanted.ID, Status: "inactive", Action: "request"}
+		}
+		if req.RequesterBookID != nil {
+			var offered models.Book
+			if err := db.First(&offered, *req.RequesterBookID).Error; err != nil {
+				return err
+			}
+			if offered.OwnerID != req.RequesterID {
+				return &ForbiddenError{Reason: "you can only offer your own books"}
+			}
+		}
+
+		var open int64
+		if err := db.Model(&models.Exchange{}).
+			Where("requester_id = ? AND responder_book_id = ?", req.RequesterID, wanted.ID).
+			Where("status IN ?", []models.Status{models.ExchangeStatusRequested, models.ExchangeStatusAccepted}).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return &StateError{Entity: "Book", ID: wanted.ID, Status: "already requested by you", Action: "request"}
+		}
+
+		now := time.Now()
+		ex = &models.Exchange{
+			RequesterID:         req.RequesterID,
+			ResponderID:         &wanted.OwnerID,
+			RequesterBookID:     req.RequesterBookID,
+			ResponderBookID:     &wanted.ID,
+			Status:              string(models.ExchangeStatusRequested),
+			RequestedAt:         &now,
+			StatusUpdatedAt:     &now,
+			AgreedStartDate:     req.AgreedStartDate,
+			AgreedEndDate:       req.AgreedEndDate,
+			ShippingRequired:    req.ShippingRequired,
+			ShippingPayerUserID: req.RequesterID,
+		}
+		if err := db.Omit(clause.Associations).Create(ex).Error; err != nil {
+			return err
+		}
+		if !req.ShippingRequired {
+			// gorm writes the column default, true, in place of a false on
+			// create. Through the table, not the model, so optlock leaves
+			// the version at 1
+			if err := db.Table("exchanges").Where("id = ?", ex.ID).Update("shipping_required", false).Error; err != nil {
+				return err
+			}
+		}
+		return notify(db, wanted.OwnerID, models.NotificationTypeExchangeRequestReceived, exchangePayload(ex, "You have a new exchange request"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, ex.ID)
+}
+
+// party is who may take a step.
+type party int
+
+const (
+	requester party = 1 << iota
+	responder
+	either = requester | responder
+)
+
+// step is one move of the exchange workflow.
+type step struct {
+	action       string
+	from         []models.Status
+	to           models.Status
+	by           party
+	notification models.NotificationType
+	message      string
+}
+
+var (
+	stepAccept = step{
+		action: "accept", to: models.ExchangeStatusAccepted, by: responder,
+		from:         []models.Status{models.ExchangeStatusRequested},
+		notification: models.NotificationTypeExchangeRequestAccepted,
+		message:      "Your exchange request was accepted",
+	}
+	stepDecline = step{
+		action: "decline", to: models.ExchangeStatusDeclined, by: responder,
+		from:         []models.Status{models.ExchangeStatusRequested},
+		notification: models.NotificationTypeExchangeRequestDeclined,
+		message:      "Your exchange request was declined",
+	}
+	stepShip = step{
+		action: "ship", to: models.ExchangeStatusShipped, by: either,
+		from:         []models.Status{models.ExchangeStatusAccepted},
+		notification: models.NotificationTypeExchangeShipped,
+		message:      "Your book has been shipped",
+	}
+	stepDeliver = step{
+		action: "mark delivered", to: models.ExchangeStatusDelivered, by: either,
+		from:         []models.Status{models.ExchangeStatusAccepted, models.ExchangeStatusShipped, models.ExchangeStatusInTransit},
+		notification: models.NotificationTypeExchangeDelivered,
+		message:      "Your book has been delivered",
+	}
+	stepComplete = step{
+		action: "complete", to: models.ExchangeStatusCompleted, by: either,
+		from:         []models.Status{models.ExchangeStatusDelivered},
+		notification: models.NotificationTypeExchangeCompleted,
+		message:      "Exchange completed successfully",
+	}
+	stepCancel = step{
+		action: "cancel", to: models.ExchangeStatusCancelled, by: either,
+		from:         []models.Status{models.ExchangeStatusRequested, models.ExchangeStatusAccepted},
+		notification: models.NotificationTypeExchangeCanceled,
+		message:      "The exchange was canceled",
+	}
+	stepDispute = step{
+		action: "dispute", to: models.ExchangeStatusInDispute, by: either,
+		from:         []models.Status{models.ExchangeStatusShipped, models.ExchangeStatusInTransit, models.ExchangeStatusDelivered},
+		notification: models.NotificationTypeExchangeDisputed,
+		message:      "A dispute was opened on the exchange",
+	}
+)
+
+// Accept accepts a requested exchange, responder only.
+func (r *ExchangeRepository) Accept(ctx context.Context, id, userID uint) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepAccept, nil)
+}
+
+// Decline declines a requested exchange, responder only.
+func (r *ExchangeRepository) Decline(ctx context.Context, id, userID uint) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepDecline, nil)
+}
+
+// Ship records that an accepted exchange was handed to provider under
+// trackingNumber.
+func (r *ExchangeRepository) Ship(ctx context.Context, id, userID uint, provider, trackingNumber string) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepShip, func(ex *models.Exchange, _ time.Time) error {
+		if !ex.ShippingRequired {
+			return &StateError{Entity: "Exchange", ID: ex.ID, Status: "set up without shipping", Action: "ship"}
+		}
+		ex.ShippingProvider = provider
+		ex.ShippingTrackingNumber = trackingNumber
+		return nil
+	})
+}
+
+// Deliver marks a shipped exchange, or an accepted one without shipping, as
+// delivered.
+func (r *ExchangeRepository) Deliver(ctx context.Context, id, userID uint) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepDeliver, func(ex *models.Exchange, _ time.Time) error {
+		if models.Status(ex.Status) == models.ExchangeStatusAccepted && ex.ShippingRequired {
+			return &StateError{Entity: "Exchange", ID: ex.ID, Status: "not shipped yet", Action: "mark delivered"}
+		}
+		return nil
+	})
+}
+
+// Complete completes a delivered exchange.
+func (r *ExchangeRepository) Complete(ctx context.Context, id, userID uint) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepComplete, func(ex *models.Exchange, now time.Time) error {
+		ex.CompletedAt = &now
+		return nil
+	})
+}
+
+// Cancel cancels an exchange that hasn't been shipped.
+func (r *ExchangeRepository) Cancel(ctx context.Context, id, userID uint) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepCancel, func(ex *models.Exchange, now time.Time) error {
+		ex.CanceledAt = &now
+		return nil
+	})
+}
+
+// Dispute opens a dispute on a shipped or delivered exchange.
+func (r *ExchangeRepository) Dispute(ctx context.Context, id, userID uint, reason string) (*models.Exchange, error) {
+	return r.take(ctx, id, userID, stepDispute, func(ex *models.Exchange, now time.Time) error {
+		ex.DisputeReason = reason
+		ex.DisputeOpenedAt = &now
+		return nil
+	})
+}
+
+// take takes step s on the exchange with id for userID, apply making the
+// step's own changes, and notifies the other participant.
+func (r *ExchangeRepository) take(ctx context.Context, id, userID uint, s step, apply func(*models.Exchange, time.Time) error) (*models.Exchange, error) {
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var ex models.Exchange
+		if err := db.First(&ex, id).Error; err != nil {
+			return err
+		}
+
+		var as party
+		switch {
+		case ex.RequesterID == userID:
+			as = requester
+		case ex.ResponderID != nil && *ex.ResponderID == userID:
+			as = responder
+		default:
+			return &ForbiddenError{Reason: "you don't take part in this exchange"}
+		}
+		if as&s.by == 0 {
+			return &ForbiddenError{Reason: fmt.Sprintf("only the %s can %s this exchange", s.by, s.action)}
+		}
+		if !slices.Contains(s.from, models.Status(ex.Status)) {
+			return &StateError{Entity: "Exchange", ID: ex.ID, Status: ex.Status, Action: s.action}
+		}
+
+		now := time.Now()
+		ex.Status = string(s.to)
+		ex.StatusUpdatedAt = &now
+		if apply != nil {
+			if err := apply(&ex, now); err != nil {
+				return err
+			}
+		}
+		if err := db.Omit(clause.Associations).Save(&ex).Error; err != nil {
+			return err
+		}
+
+		other := &ex.RequesterID
+		if as == requester {
+			// nil once the responder's account is gone
+			other = ex.ResponderID
+		}
+		if other == nil {
+			return nil
+		}
+		return notify(db, *other, s.notification, exchangePayload(&ex, s.message))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (p party) String() string {
+	switch p {
+	case requester:
+		return "requester"
+	case responder:
+		return "responder"
+	}
+	return "participants"
+}
+
+// exchangePayload is the payload of an exchange notification.
+func exchangePayload(ex *models.Exchange, message string) map[string]any {
+	return map[string]any{"message": message, "exchange_id": ex.ID, "status": ex.Status}
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/softdelete"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationRepository is the inbox of a user. Every call is scoped to the
+// user, a notification of someone else is as missing as one that doesn't
+// exist.
+type NotificationRepository struct {
+	tm *txmanager.Manager
+}
+
+// unread matches unread notifications; read is a reserved word in MySQL, the
+// column has to go through clause.Column to be quoted.
+var unread = clause.Eq{Column: clause.Column{Name: "read"}, Value: false}
+
+// List returns a page of the notifications of userID filtered and sorted by
+// q (see models.Notification.FilterSpec), newest first unless q sorts.
+func (r *NotificationRepository) List(ctx context.Context, userID uint, q url.Values, req pagination.Request) (*pagination.Page[models.Notification], error) {
+	spec := models.Notification{}.FilterSpec()
+	where, err := spec.Where(q)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := spec.SortKeys(q, pagination.Desc("created_at"))
+	if err != nil {
+		return nil, err
+	}
+	db := r.tm.DB(ctx).Model(&models.Notification{}).Where("user_id = ?", userID).Scopes(where)
+	return pagination.Paginate[models.Notification](db, keys, req)
+}
+
+// UnreadCount returns how many unread notifications userID has, a range of
+// idx_notifications_inbox.
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID uint) (int64, error) {
+	var n int64
+	err := r.tm.DB(ctx).Model(&models.Notification{}).Where("user_id = ?", userID).Where(unread).Count(&n).Error
+	return n, err
+}
+
+// SetRead marks the notification with id of userID read or unread.
+func (r *NotificationRepository) SetRead(ctx context.Context, userID, id uint, read bool) (*models.Notification, error) {
+	var n models.Notification
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		if err := db.Where("user_id = ?", userID).First(&n, id).Error; err != nil {
+			return err
+		}
+		return db.Model(&n).Update("read", read).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// MarkAllRead marks the unread notifications of userID matching q read,
+// type=exchange_shipped only those of a type, and returns how many it marked.
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID uint, q url.Values) (int64, error) {
+	where, err := models.Notification{}.FilterSpec().Where(q)
+	if err != nil {
+		return 0, err
+	}
+	res := r.tm.DB(ctx).Model(&models.Notification{}).
+		Where("user_id = ?", userID).
+		Where(unread).
+		Scopes(where).
+		Update("read", true)
+	return res.RowsAffected, res.Error
+}
+
+// Delete moves the notification with id of userID to the trash.
+func (r *NotificationRepository) Delete(ctx context.Context, userID, id uint) error {
+	return r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var n models.Notification
+		if err := db.Select("id").Where("user_id = ?", userID).First(&n, id).Error; err != nil {
+			return err
+		}
+		return softdelete.Delete[models.Notification](db, n.ID)
+	})
+}
+
+// Since returns up to limit notifications of userID after the one with
+// afterID, oldest first: what a client resuming its event stream missed.
+func (r *NotificationRepository) Since(ctx context.Context, userID, afterID uint, limit int) ([]models.Notification, error) {
+	var ns []models.Notification
+	if err := r.tm.DB(ctx).Where("user_id = ? AND id > ?", userID, afterID).Order("id").Limit(limit).Find(&ns).Error; err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// ResumeAfter returns the id after which a client resuming its event stream
+// after the notification of userID with lastID is replayed (see Since).
+// Notification ids are taken on insert, not on commit: one with a lower id
+// may commit, and be missed, after lastID was streamed. The replay goes
+// back to the notifications created within overlap before lastID, the
+// client may get some of them again.
+func (r *NotificationRepository) ResumeAfter(ctx context.Context, userID, lastID uint, overlap time.Duration) (uint, error) {
+	db := r.tm.DB(ctx)
+	var last models.Notification
+	res := db.Unscoped().Select("id", "created_at").Where("id = ? AND user_id = ?", lastID, userID).Limit(1).Find(&last)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 || last.CreatedAt == nil {
+		// not the user's, nothing to go back from
+		return lastID, nil
+	}
+	var first uint
+	if err := db.Model(&models.Notification{}).Select("COALESCE(MIN(id), 0)").
+		Where("user_id = ? AND id < ? AND created_at >= ?", userID, lastID, last.CreatedAt.Add(-overlap)).
+		Scan(&first).Error; err != nil {
+		return 0, err
+	}
+	if first == 0 {
+		return lastID, nil
+	}
+	return first - 1, nil
+}
+
+// notify inserts a notification for userID with payload encoded as its JSON
+// payload, in the transaction of db if it has one.
+func notify(db *gorm.DB, userID uint, typ models.NotificationType, payload map[string]any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return db.Create(&models.Notification{UserID: userID, Type: typ, Payload: string(raw)}).Error
+}
@@ -0,0 +1,46 @@
+// Package repository is the data access of the HTTP API.
+//
+// Repositories don't hold a *gorm.DB, they ask the txmanager for one on every
+// call, so a repository used inside tm.Do joins the caller's transaction:
+//
+//	err := repos.Tx.Do(ctx, func(ctx context.Context) error {
+//		user, err := repos.Users.Get(ctx, id) // read in the transaction
+//		...
+//	})
+//
+// Errors are the typed ones of dberrors (the plugin translates them), a
+// missing row is a *dberrors.ErrNotFound.
+package repository
+
+import (
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+)
+
+// Repositories are the repositories of the application, sharing one
+// transaction manager.
+type Repositories struct {
+	Tx            *txmanager.Manager
+	Users         *UserRepository
+	Books         *BookRepository
+	Exchanges     *ExchangeRepository
+	Communities   *CommunityRepository
+	Subscriptions *SubscriptionRepository
+	Notifications *NotificationRepository
+	Chat          *ChatRepository
+	Accounts      *AccountRepository
+}
+
+// New returns the repositories reading and writing through tm.
+func New(tm *txmanager.Manager) *Repositories {
+	return &Repositories{
+		Tx:            tm,
+		Users:         &UserRepository{tm: tm},
+		Books:         &BookRepository{tm: tm},
+		Exchanges:     &ExchangeRepository{tm: tm},
+		Communities:   &CommunityRepository{tm: tm},
+		Subscriptions: &SubscriptionRepository{tm: tm},
+		Notifications: &NotificationRepository{tm: tm},
+		Chat:          &ChatRepository{tm: tm},
+		Accounts:      &AccountRepository{tm: tm},
+	}
+}
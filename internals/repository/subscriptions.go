@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/dberrors"
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/pagination"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A user has at most one current subscription: an active or trialing one
+// whose period hasn't ended, or a past due one waiting for its payment.
+// Canceling only sets cancel_at_period_end, the subscription stays current
+// until its period ends; nothing renews subscriptions yet, so one past its
+// period is settled (expired, or canceled when it was set to) the next time
+// its user subscribes.
+type SubscriptionRepository struct {
+	tm *txmanager.Manager
+}
+
+// current scopes subscriptions to the current ones at now.
+func current(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(status IN ? AND (current_period_end IS NULL OR current_period_end > ?)) OR status = ?",
+			[]models.SubscriptionStatus{models.SubscriptionStatusActive, models.SubscriptionStatusTrialing}, now,
+			models.SubscriptionStatusPastDue)
+	}
+}
+
+// Plans returns the active plans, cheapest first.
+func (r *SubscriptionRepository) Plans(ctx context.Context) ([]models.SubscriptionPlan, error) {
+	var plans []models.SubscriptionPlan
+	if err := r.tm.DB(ctx).Where("active = ?", true).Order("price_cents, id").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// Current returns the current subscription of userID with its plan, a
+// *dberrors.ErrNotFound when they have none.
+func (r *SubscriptionRepository) Current(ctx context.Context, userID uint) (*models.Subscription, error) {
+	var sub models.Subscription
+	if err := r.tm.DB(ctx).Preload("Plan").
+		Where("user_id = ?", userID).
+		Scopes(current(time.Now())).
+		First(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Subscribe subscribes userID to the active plan with planID for one period
+// starting now and records its payment. Paid plans are charged as succeeded,
+// no payment provider is wired in yet.
+//
+// The user row is locked first, so two subscribes of the same user run one
+// after the other and the second one sees the first's subscription.
+func (r *SubscriptionRepository) Subscribe(ctx context.Context, userID, planID uint) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := r.tm.Do(ctx, func(ctx context.Context) error {
+		db := r.tm.DB(ctx)
+		var plan models.SubscriptionPlan
+		if err := db.First(&plan, planID).Error; err != nil {
+			return err
+		}
+		if !plan.Active {
+			return &StateError{Entity: "SubscriptionPlan", ID: plan.ID, Status: "inactive", Action: "subscribe to"}
+		}
+
+		var user models.User
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := r.settle(db, userID, now); err != nil {
+			return err
+		}
+		var existing models.Subscription
+		err := db.Where("user_id = ?", userID).Scopes(current(now)).First(&existing).Error
+		var notFound *dberrors.ErrNotFound
+		switch {
+		case err == nil:
+			// a plan change waits for the current period to end
+			return &StateError{Entity: "Subscription", ID: existing.ID, Status: string(existing.Status), Action: "replace"}
+		case !errors.As(err, &notFound):
+			return err
+		}
+
+		end := plan.Interval.After(now)
+		sub = models.Subscription{
+			UserID:             userID,
+			PlanID:             plan.ID,
+			Status:             models.SubscriptionStatusActive,
+			CurrentPeriodStart: &now,
+			CurrentPeriodEnd:   &end,
+		}
+		if err := db.Omit(clause.Associations).Create(&sub).Error; err != nil {
+			return err
+		}
+		if plan.PriceCents == 0 {
+			return nil
+		}
+
+		metadata, err := json.Marshal(map[string]any{"plan": plan.Slug, "currency": plan.Currency, "period_start": now, "period_end": end})
+		if err != nil {
+			return err
+		}
+		return db.Omit(clause.Associations).Create(&models.Payment{
+			UserID:         userID,
+			SubscriptionID: sub.ID,
+			AmountCents:    float64(plan.PriceCents),
+			Status:         models.PaymentStatusSucceeded,
+			Metadata:       datatypes.JSON(metadata),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Current(ctx, userID)
+}
+
+// settle closes the subscriptions of userID whose period ended by now.
+func (r *SubscriptionRepository) settle(db *gorm.DB, userID uint, now time.Time) error {
+	lapsed := db.Model(&models.Subscription{}).
+		Where("user_id = ? AND status IN ? AND current_period_end <= ?", userID,
+			[]models.SubscriptionStatus{models.SubscriptionStatusActive, models.SubscriptionStatusTrialing}, now).
+		Session(&gorm.Session{})
+	if err := lapsed.Where("cancel_at_period_end = ?", true).
+		Update("status", models.SubscriptionStatusCanceled).Error; err != nil {
+		return err
+	}
+	return lapsed.Update("status", models.SubscriptionStatusExpired).Error
+}
+
+// Cancel sets the current subscription of userID to end with its period.
+func (r *SubscriptionRepository) Cancel(ctx context.Context, userID uint) (*models.Subscription, error) {
+	return r.setCancel(ctx, userID, true)
+}
+
+// Resume undoes Cancel while the period hasn't ended.
+func (r *SubscriptionRepository) Resume(ctx context.Context, userID uint) (*models.Subscription, error) {
+	return r.setCancel(ctx, userID, false)
+}
+
+func (r *SubscriptionRepository) setCancel(ctx context.Context, userID uint, cancel bool) (*models.Subscription, error) {
+	sub, err := r.Current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cancel && sub.CancelAtPeriodEnd:
+		return nil, &StateError{Entity: "Subscription", ID: sub.ID, Status: "already canceled at period end", Action: "cancel"}
+	case !cancel && !sub.CancelAtPeriodEnd:
+		return nil, &StateError{Entity: "Subscription", ID: sub.ID, Status: "not canceled", Action: "resume"}
+	}
+	// under the version read (optlock), of a cancel and a resume racing one
+	// gets a conflict
+	if err := r.tm.DB(ctx).Model(sub).Omit(clause.Associations).Update("cancel_at_period_end", cancel).Error; err != nil {
+		return nil, err
+	}
+	return r.Current(ctx, userID)
+}
+
+// Payments returns a page of the payments of userID, newest first.
+func (r *SubscriptionRepository) Payments(ctx context.Context, userID uint, req pagination.Request) (*pagination.Page[models.Payment], error) {
+	db := r.tm.DB(ctx).Model(&models.Payment{}).Where("user_id = ?", userID)
+	return pagination.Paginate[models.Payment](db, []pagination.Key{pagination.Desc("created_at")}, req)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Amanuel-0/gorm-pg/internals/database/models"
+	"github.com/Amanuel-0/gorm-pg/internals/database/txmanager"
+)
+
+type UserRepository struct {
+	tm *txmanager.Manager
+}
+
+// Get returns the user with id, with its UserProfile.
+func (r *UserRepository) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.tm.DB(ctx).Preload("UserProfile").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -15,6 +15,9 @@ func PrettyPrint(data any, message string) {
 	fmt.Printf("%s: %s\n", message, string(jsonData))
 }
 
+// CollectFieldPtrs returns pointers to the fields of v in declaration order,
+// to be passed to Scan. It relies on the SELECT listing columns in exactly
+// that order; for joined queries rowmapper matches columns by alias instead.
 func CollectFieldPtrs(v reflect.Value) []any {
 	var result []any
 